@@ -18,14 +18,20 @@ create table if not exists public.baked_repos
   -- synced to baked_repos.
   repo_id bigint default null,
 
+  -- the hash of the HEAD commit when the repo was last indexed. Commits
+  -- reachable from this hash are not walked again on subsequent bakes.
+  last_indexed_hash character varying(255) collate pg_catalog."default" default null,
+  last_indexed_at timestamp with time zone default null,
+
   -- dynamic columns
   constraint baked_repos_pkey primary key (id)
 )
 
 tablespace pg_default;
 
--- indexes for baked repos
-create index if not exists baked_repos_idx_clone_url on baked_repos (clone_url);
+-- columns added after the table was first created
+alter table public.baked_repos add column if not exists last_indexed_hash character varying(255) collate pg_catalog."default" default null;
+alter table public.baked_repos add column if not exists last_indexed_at timestamp with time zone default null;
 
 -------------------------------------
 -- Pizza oven commit authors table --
@@ -35,14 +41,37 @@ create table if not exists public.commit_authors
   id bigint not null generated by default as identity ( increment 1 start 1 minvalue 1 maxvalue 9223372036854775807 cache 1 ),
   commit_author_email character varying(255) collate pg_catalog."default" not null,
 
+  -- the display name of the author, which is the name most recently seen
+  -- for the author's email. See commit_author_names.
+  commit_author_name character varying(255) collate pg_catalog."default" default null,
+
   -- dynamic columns
   constraint commit_authors_pkey primary key (id)
 )
 
 tablespace pg_default;
 
--- indexes for baked repos
-create index if not exists commit_authors_idx_commit_author_email on commit_authors (commit_author_email);
+-- columns added after the table was first created
+alter table public.commit_authors add column if not exists commit_author_name character varying(255) collate pg_catalog."default" default null;
+
+------------------------------------------
+-- Pizza oven commit author names table --
+------------------------------------------
+
+-- every name seen for a commit author's email along with when it was first
+-- and last seen on a commit
+create table if not exists public.commit_author_names
+(
+  commit_author_id bigint not null references public.commit_authors (id) on delete cascade on update cascade,
+  commit_author_name character varying(255) collate pg_catalog."default" not null,
+  first_seen_at timestamp with time zone not null,
+  last_seen_at timestamp with time zone not null,
+
+  -- dynamic columns
+  constraint commit_author_names_pkey primary key (commit_author_id, commit_author_name)
+)
+
+tablespace pg_default;
 
 --------------------------------
 -- Pizza oven indexed commits --
@@ -52,8 +81,39 @@ create table if not exists public.commits (
   id bigint not null generated by default as identity ( increment 1 start 1 minvalue 1 maxvalue 9223372036854775807 cache 1 ),
   baked_repo_id bigint not null references public.baked_repos (id) on delete cascade on update cascade,
   commit_author_id bigint not null references public.commit_authors(id) on delete cascade on update cascade,
+
+  -- the committer is the person who applied the commit which may differ from
+  -- the author of the commit (i.e., a maintainer landing a contributor's patch)
+  commit_committer_id bigint default null references public.commit_authors(id) on delete cascade on update cascade,
+
+  -- commit authors and committers are canonical identities resolved through
+  -- the repo's .mailmap. The raw emails found on the commit are kept for auditing.
+  commit_author_raw_email character varying(255) collate pg_catalog."default" default null,
+  commit_committer_raw_email character varying(255) collate pg_catalog."default" default null,
   commit_hash character varying(255) collate pg_catalog."default" not null,
+
+  -- the commit_date is the date the commit was committed while the
+  -- commit_author_date is the date it was originally authored
   commit_date timestamp with time zone not null default now(),
+  commit_author_date timestamp with time zone default null,
+
+  -- the subject is the first paragraph of the commit message. The full
+  -- message may be truncated depending on the pizza oven's configuration.
+  commit_subject text collate pg_catalog."default" default null,
+  commit_message text collate pg_catalog."default" default null,
+  commit_parent_hashes character varying(255)[] default null,
+  commit_is_merge boolean not null default false,
+
+  -- line and file change statistics are only collected when requested and
+  -- are null otherwise. See commit_file_changes.
+  commit_additions integer default null,
+  commit_deletions integer default null,
+  commit_files_changed integer default null,
+
+  -- when a repo's history is rewritten (i.e., force-pushed), commits that are
+  -- no longer reachable from its HEAD are marked with the time they became
+  -- unreachable. Reachable commits have a null unreachable_at.
+  unreachable_at timestamp with time zone default null,
 
   -- dynamic columns
   constraint commits_pkey primary key (id)
@@ -61,7 +121,359 @@ create table if not exists public.commits (
 
 tablespace pg_default;
 
+-- columns added after the table was first created
+alter table public.commits add column if not exists commit_committer_id bigint default null references public.commit_authors(id) on delete cascade on update cascade;
+alter table public.commits add column if not exists commit_author_raw_email character varying(255) collate pg_catalog."default" default null;
+alter table public.commits add column if not exists commit_committer_raw_email character varying(255) collate pg_catalog."default" default null;
+alter table public.commits add column if not exists commit_author_date timestamp with time zone default null;
+alter table public.commits add column if not exists commit_subject text collate pg_catalog."default" default null;
+alter table public.commits add column if not exists commit_message text collate pg_catalog."default" default null;
+alter table public.commits add column if not exists commit_parent_hashes character varying(255)[] default null;
+alter table public.commits add column if not exists commit_is_merge boolean not null default false;
+alter table public.commits add column if not exists commit_additions integer default null;
+alter table public.commits add column if not exists commit_deletions integer default null;
+alter table public.commits add column if not exists commit_files_changed integer default null;
+alter table public.commits add column if not exists unreachable_at timestamp with time zone default null;
+
 -- psql indexes for commits
 create index if not exists commit_idx_hash on commits (commit_hash);
 create index if not exists commit_idx_date on commits (commit_date);
+create index if not exists commit_idx_author_id on commits (commit_author_id);
+create index if not exists commit_idx_committer_id on commits (commit_committer_id);
+create index if not exists commit_idx_merge_date on commits (baked_repo_id, commit_date) where commit_is_merge;
+create index if not exists commit_idx_baked_repo_id_date_id on commits (baked_repo_id, commit_date desc, id desc);
+create index if not exists commit_idx_reachable_baked_repo_id_date_author_id on commits (baked_repo_id, commit_date, commit_author_id) where unreachable_at is null;
+
+-- commits are unique per repo. Any duplicate commits that were indexed before
+-- this constraint existed are removed so the unique index may be built.
+delete from commits a using commits b
+where a.baked_repo_id = b.baked_repo_id and a.commit_hash = b.commit_hash and a.id > b.id;
+
+create unique index if not exists commit_idx_baked_repo_id_hash on commits (baked_repo_id, commit_hash);
+
+----------------------------------------
+-- Pizza oven commit co-authors table --
+----------------------------------------
+
+-- links commits to the people credited through "Co-authored-by" trailers
+create table if not exists public.commit_coauthors
+(
+  commit_id bigint not null references public.commits (id) on delete cascade on update cascade,
+  commit_author_id bigint not null references public.commit_authors (id) on delete cascade on update cascade,
+
+  -- dynamic columns
+  constraint commit_coauthors_pkey primary key (commit_id, commit_author_id)
+)
+
+tablespace pg_default;
+
+-- psql indexes for commit co-authors
+create index if not exists commit_coauthors_idx_commit_author_id on commit_coauthors (commit_author_id);
+
+-- commit authors are unique by their email. Any duplicate authors that were
+-- inserted before this constraint existed are merged into the oldest author
+-- with the same email, along with their commits, co-authored commits and
+-- names, so the unique index may be built.
+create or replace temporary view duplicate_authors as
+select id, min(id) over (partition by commit_author_email) as keep_id
+from commit_authors;
+
+update commits c set commit_author_id = d.keep_id
+from duplicate_authors d
+where c.commit_author_id = d.id and d.id <> d.keep_id;
+
+update commits c set commit_committer_id = d.keep_id
+from duplicate_authors d
+where c.commit_committer_id = d.id and d.id <> d.keep_id;
+
+insert into commit_coauthors (commit_id, commit_author_id)
+select ca.commit_id, d.keep_id
+from commit_coauthors ca
+join duplicate_authors d on d.id = ca.commit_author_id
+where d.id <> d.keep_id
+on conflict do nothing;
+
+insert into commit_author_names (commit_author_id, commit_author_name, first_seen_at, last_seen_at)
+select d.keep_id, n.commit_author_name, min(n.first_seen_at), max(n.last_seen_at)
+from commit_author_names n
+join duplicate_authors d on d.id = n.commit_author_id
+where d.id <> d.keep_id
+group by 1, 2
+on conflict (commit_author_id, commit_author_name) do update
+set first_seen_at = least(commit_author_names.first_seen_at, excluded.first_seen_at),
+  last_seen_at = greatest(commit_author_names.last_seen_at, excluded.last_seen_at);
+
+delete from commit_authors a using commit_authors b
+where a.commit_author_email = b.commit_author_email and a.id > b.id;
+
+drop view duplicate_authors;
+
+-- indexes for commit authors
+drop index if exists commit_authors_idx_commit_author_email;
+create unique index if not exists commit_authors_idx_unique_commit_author_email on commit_authors (commit_author_email);
+
+-----------------------------------------
+-- Pizza oven commit file changes table --
+-----------------------------------------
+
+-- the changes made to each file in a commit. Only collected when requested.
+create table if not exists public.commit_file_changes
+(
+  id bigint not null generated by default as identity ( increment 1 start 1 minvalue 1 maxvalue 9223372036854775807 cache 1 ),
+  commit_id bigint not null references public.commits (id) on delete cascade on update cascade,
+  file_path text collate pg_catalog."default" not null,
+
+  -- the path of the file before it was renamed. Null for all other changes.
+  previous_file_path text collate pg_catalog."default" default null,
+  additions integer not null default 0,
+  deletions integer not null default 0,
+
+  -- one of "added", "modified", "deleted" or "renamed"
+  change_type character varying(32) collate pg_catalog."default" not null,
+
+  -- dynamic columns
+  constraint commit_file_changes_pkey primary key (id)
+)
+
+tablespace pg_default;
+
+-- psql indexes for commit file changes
+create unique index if not exists commit_file_changes_idx_commit_id_path on commit_file_changes (commit_id, file_path);
+
+----------------------------
+-- Pizza oven refs tables --
+----------------------------
+
+-- the remote branches and tags of repos baked with all refs as of their last
+-- bake. Refs that are deleted upstream are removed on the next bake.
+create table if not exists public.refs
+(
+  id bigint not null generated by default as identity ( increment 1 start 1 minvalue 1 maxvalue 9223372036854775807 cache 1 ),
+  baked_repo_id bigint not null references public.baked_repos (id) on delete cascade on update cascade,
+  ref_name character varying(255) collate pg_catalog."default" not null,
+
+  -- one of "branch" or "tag"
+  ref_type character varying(32) collate pg_catalog."default" not null,
+
+  -- the hash of the commit the ref points to. Annotated tags are peeled to
+  -- the commit they tag.
+  target_hash character varying(255) collate pg_catalog."default" not null,
+
+  -- the tagger date of annotated tags or the commit date of lightweight tags.
+  -- Null for branches.
+  tag_date timestamp with time zone default null,
+  updated_at timestamp with time zone not null default now(),
+
+  -- dynamic columns
+  constraint refs_pkey primary key (id)
+)
+
+tablespace pg_default;
+
+-- psql indexes for refs
+create unique index if not exists refs_idx_baked_repo_id_type_name on refs (baked_repo_id, ref_type, ref_name);
+
+-- the refs each commit is reachable from
+create table if not exists public.commit_refs
+(
+  commit_id bigint not null references public.commits (id) on delete cascade on update cascade,
+  ref_id bigint not null references public.refs (id) on delete cascade on update cascade,
+
+  -- dynamic columns
+  constraint commit_refs_pkey primary key (commit_id, ref_id)
+)
+
+tablespace pg_default;
+
+-- psql indexes for commit refs
+create index if not exists commit_refs_idx_ref_id on commit_refs (ref_id);
+
+---------------------------------------
+-- Pizza oven commit activity rollup --
+---------------------------------------
+
+-- the number of reachable commits of each repo per UTC day of their commit
+-- date. Maintained at the end of each bake for the days it affected.
+create table if not exists public.commit_activity_daily
+(
+  baked_repo_id bigint not null references public.baked_repos (id) on delete cascade on update cascade,
+  activity_date date not null,
+  commit_count bigint not null default 0,
+
+  -- dynamic columns
+  constraint commit_activity_daily_pkey primary key (baked_repo_id, activity_date)
+)
+
+tablespace pg_default;
+
+-- repos that were baked before the rollup existed are backfilled once, while
+-- the rollup is still empty
+insert into commit_activity_daily (baked_repo_id, activity_date, commit_count)
+select baked_repo_id, (commit_date at time zone 'UTC')::date, count(*)
+from commits
+where unreachable_at is null
+and not exists (select 1 from commit_activity_daily)
+group by 1, 2;
+
+-------------------------------------
+-- Pizza oven duplicate repo merge --
+-------------------------------------
+
+-- repos are unique by their clone URL. Any duplicate repos that were inserted
+-- by concurrent bakes before this constraint existed are merged into the
+-- oldest repo with the same clone URL so the unique index may be built. Their
+-- refs and commits are moved to the oldest repo, or merged into the ones it
+-- already has, and its commit activity is recounted.
+create or replace temporary view duplicate_repos as
+select id, min(id) over (partition by clone_url) as keep_id
+from baked_repos;
+
+create or replace temporary view duplicate_refs as
+select f.id, first_value(f.id) over (
+  partition by r.keep_id, f.ref_type, f.ref_name
+  order by f.baked_repo_id = r.keep_id desc, f.updated_at desc, f.id
+) as keep_id
+from refs f
+join duplicate_repos r on r.id = f.baked_repo_id
+where r.keep_id in (select keep_id from duplicate_repos where id <> keep_id);
+
+create or replace temporary view duplicate_commits as
+select c.id, first_value(c.id) over (
+  partition by r.keep_id, c.commit_hash
+  order by c.baked_repo_id = r.keep_id desc, c.id
+) as keep_id
+from commits c
+join duplicate_repos r on r.id = c.baked_repo_id
+where r.keep_id in (select keep_id from duplicate_repos where id <> keep_id);
+
+insert into commit_refs (commit_id, ref_id)
+select cr.commit_id, d.keep_id
+from commit_refs cr
+join duplicate_refs d on d.id = cr.ref_id
+where d.id <> d.keep_id
+on conflict do nothing;
+
+delete from refs f using duplicate_refs d
+where f.id = d.id and d.id <> d.keep_id;
+
+update refs f set baked_repo_id = r.keep_id
+from duplicate_repos r
+where f.baked_repo_id = r.id and r.id <> r.keep_id;
+
+insert into commit_coauthors (commit_id, commit_author_id)
+select d.keep_id, ca.commit_author_id
+from commit_coauthors ca
+join duplicate_commits d on d.id = ca.commit_id
+where d.id <> d.keep_id
+on conflict do nothing;
+
+insert into commit_file_changes (commit_id, file_path, previous_file_path, additions, deletions, change_type)
+select d.keep_id, fc.file_path, fc.previous_file_path, fc.additions, fc.deletions, fc.change_type
+from commit_file_changes fc
+join duplicate_commits d on d.id = fc.commit_id
+where d.id <> d.keep_id
+on conflict do nothing;
+
+insert into commit_refs (commit_id, ref_id)
+select d.keep_id, cr.ref_id
+from commit_refs cr
+join duplicate_commits d on d.id = cr.commit_id
+where d.id <> d.keep_id
+on conflict do nothing;
+
+delete from commits c using duplicate_commits d
+where c.id = d.id and d.id <> d.keep_id;
+
+update commits c set baked_repo_id = r.keep_id
+from duplicate_repos r
+where c.baked_repo_id = r.id and r.id <> r.keep_id;
+
+delete from commit_activity_daily a using duplicate_repos r
+where a.baked_repo_id = r.keep_id and r.id <> r.keep_id;
+
+insert into commit_activity_daily (baked_repo_id, activity_date, commit_count)
+select baked_repo_id, (commit_date at time zone 'UTC')::date, count(*)
+from commits
+where unreachable_at is null
+and baked_repo_id in (select keep_id from duplicate_repos where id <> keep_id)
+group by 1, 2;
+
+delete from baked_repos a using baked_repos b
+where a.clone_url = b.clone_url and a.id > b.id;
+
+drop view duplicate_commits, duplicate_refs, duplicate_repos;
+
+-- indexes for baked repos
+drop index if exists baked_repos_idx_clone_url;
+create unique index if not exists baked_repos_idx_unique_clone_url on baked_repos (clone_url);
+
+-------------------------------
+-- Pizza oven bake job queue --
+-------------------------------
+
+create table if not exists public.bake_jobs
+(
+  id uuid not null,
+  clone_url character varying(255) collate pg_catalog."default" not null,
+
+  -- the optional settings the job was requested with. See jobs.Options
+  options jsonb not null default '{}'::jsonb,
+  status character varying(32) collate pg_catalog."default" not null default 'queued',
+  attempts integer not null default 0,
+  commits_inserted bigint not null default 0,
+  error text collate pg_catalog."default" default null,
+  created_at timestamp with time zone not null default now(),
+  started_at timestamp with time zone default null,
+  finished_at timestamp with time zone default null,
+
+  -- workers periodically update the heartbeat of the jobs they are running.
+  -- Running jobs with a stale heartbeat (i.e. the worker's pod restarted)
+  -- are re-claimed by other workers.
+  heartbeat_at timestamp with time zone default null,
+
+  -- the step of processing a running job is at, see jobs.Phase, and the
+  -- number of commits walked in that step so far
+  phase character varying(32) collate pg_catalog."default" default null,
+  phase_count bigint not null default 0,
+
+  -- identifies the attempt of the worker that last claimed the job. Workers
+  -- whose job was re-claimed by another worker may no longer update it.
+  claim_id uuid default null,
+
+  -- dynamic columns
+  constraint bake_jobs_pkey primary key (id)
+)
+
+tablespace pg_default;
+
+-- columns added after the table was first created
+alter table public.bake_jobs add column if not exists options jsonb not null default '{}'::jsonb;
+alter table public.bake_jobs add column if not exists phase character varying(32) collate pg_catalog."default" default null;
+alter table public.bake_jobs add column if not exists phase_count bigint not null default 0;
+
+-- psql indexes for bake jobs
+create index if not exists bake_jobs_idx_status_created_at on bake_jobs (status, created_at);
+create index if not exists bake_jobs_idx_clone_url_created_at on bake_jobs (clone_url, created_at);
+
+-- only a single queued or running job may exist for a repo and set of options
+-- at any given time. Subsequent bake requests for that repo with the same
+-- options are coalesced into the active job.
+create unique index if not exists bake_jobs_idx_active_clone_url_options on bake_jobs (clone_url, options) where status in ('queued', 'running');
+
+-- the URLs notified when a bake job finishes. Requests that are coalesced into
+-- an active job each add their own callback to it.
+create table if not exists public.bake_job_callbacks
+(
+  id bigint not null generated by default as identity ( increment 1 start 1 minvalue 1 maxvalue 9223372036854775807 cache 1 ),
+  job_id uuid not null references public.bake_jobs (id) on delete cascade on update cascade,
+  callback_url text collate pg_catalog."default" not null,
+  created_at timestamp with time zone not null default now(),
+
+  -- dynamic columns
+  constraint bake_job_callbacks_pkey primary key (id)
+)
+
+tablespace pg_default;
 
+-- psql indexes for bake job callbacks
+create index if not exists bake_job_callbacks_idx_job_id on bake_job_callbacks (job_id);
@@ -1,18 +1,23 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"log"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 	"go.uber.org/zap"
 	"gopkg.in/yaml.v3"
 
 	"github.com/open-sauced/pizza/oven/pkg/database"
+	"github.com/open-sauced/pizza/oven/pkg/jobs"
+	"github.com/open-sauced/pizza/oven/pkg/mailmap"
 	"github.com/open-sauced/pizza/oven/pkg/providers"
 	"github.com/open-sauced/pizza/oven/pkg/server"
+	"github.com/open-sauced/pizza/oven/pkg/webhooks"
 )
 
 func main() {
@@ -72,9 +77,34 @@ func main() {
 	pizzaOven := database.NewPizzaOvenDbHandler(databaseHost, databasePort, databaseUser, databasePwd, databaseDbName, sslmode)
 
 	// Initializes configuration using a provided yaml file
-	config := &server.Config{NeverEvictRepos: make(map[string]bool)}
+	config := &server.Config{
+		NeverEvictRepos:       make(map[string]bool),
+		AllRefsRepos:          make(map[string]bool),
+		ScheduleRepoIntervals: make(map[string]time.Duration),
+		WebhookSecrets:        make(map[webhooks.Provider]string),
+		BakeWorkers:           server.DefaultBakeWorkers,
+		MaxBakeAttempts:       server.DefaultMaxBakeAttempts,
+		RewrittenHistoryMode:  server.RewrittenHistoryMark,
+		ShutdownTimeout:       server.DefaultShutdownTimeout,
+		PhaseTimeouts:         make(map[jobs.Phase]time.Duration),
+	}
 	var configParser struct {
-		NeverEvictRepos []string `yaml:"never-evict-repos"`
+		NeverEvictRepos  []string                 `yaml:"never-evict-repos"`
+		BakeWorkers      int                      `yaml:"bake-workers"`
+		MaxBakeAttempts  int                      `yaml:"max-bake-attempts"`
+		RewrittenHistory string                   `yaml:"rewritten-history"`
+		MailmapFile      string                   `yaml:"mailmap-file"`
+		MaxMessageBytes  int                      `yaml:"max-commit-message-bytes"`
+		CommitStats      bool                     `yaml:"commit-stats"`
+		AllRefsRepos     []string                 `yaml:"all-refs-repos"`
+		ScheduleInterval time.Duration            `yaml:"schedule-interval"`
+		ScheduleJitter   time.Duration            `yaml:"schedule-jitter"`
+		ScheduleRepos    map[string]time.Duration `yaml:"schedule-repos"`
+		WebhookSecrets   map[string]string        `yaml:"webhook-secrets"`
+		WebhookKnownOnly bool                     `yaml:"webhook-known-repos-only"`
+		CallbackSecret   string                   `yaml:"callback-secret"`
+		ShutdownTimeout  time.Duration            `yaml:"shutdown-timeout"`
+		PhaseTimeouts    map[string]time.Duration `yaml:"phase-timeouts"`
 	}
 
 	if configPath != "" {
@@ -91,6 +121,90 @@ func main() {
 		for _, repo := range configParser.NeverEvictRepos {
 			config.NeverEvictRepos[repo] = true
 		}
+
+		if configParser.BakeWorkers > 0 {
+			config.BakeWorkers = configParser.BakeWorkers
+		}
+
+		if configParser.MaxBakeAttempts > 0 {
+			config.MaxBakeAttempts = configParser.MaxBakeAttempts
+		}
+
+		switch mode := server.RewrittenHistoryMode(configParser.RewrittenHistory); mode {
+		case "":
+		case server.RewrittenHistoryMark, server.RewrittenHistoryDelete:
+			config.RewrittenHistoryMode = mode
+		default:
+			sugarLogger.Fatalf("Invalid rewritten-history mode %s, expected one of: mark, delete", mode)
+		}
+
+		if configParser.MailmapFile != "" {
+			mailmapFile, err := os.ReadFile(configParser.MailmapFile)
+			if err != nil {
+				sugarLogger.Fatalf("Could not read mailmap file: %s", err.Error())
+			}
+
+			config.Mailmap, err = mailmap.Parse(bytes.NewReader(mailmapFile))
+			if err != nil {
+				sugarLogger.Fatalf("Could not parse mailmap file: %s", err.Error())
+			}
+		}
+
+		config.MaxCommitMessageBytes = configParser.MaxMessageBytes
+		config.CommitStats = configParser.CommitStats
+
+		for _, repo := range configParser.AllRefsRepos {
+			config.AllRefsRepos[repo] = true
+		}
+
+		if configParser.ScheduleInterval < 0 || configParser.ScheduleJitter < 0 {
+			sugarLogger.Fatalf("Invalid schedule-interval or schedule-jitter, expected positive durations")
+		}
+
+		config.ScheduleInterval = configParser.ScheduleInterval
+		config.ScheduleJitter = configParser.ScheduleJitter
+
+		for repo, interval := range configParser.ScheduleRepos {
+			config.ScheduleRepoIntervals[repo] = interval
+		}
+
+		for name, secret := range configParser.WebhookSecrets {
+			provider := webhooks.Provider(name)
+			if !provider.Valid() {
+				sugarLogger.Fatalf("Invalid webhook provider %s, expected one of: github, gitlab, gitea", name)
+			}
+
+			if secret == "" {
+				sugarLogger.Fatalf("Empty webhook secret for provider: %s", name)
+			}
+
+			config.WebhookSecrets[provider] = secret
+		}
+
+		config.WebhookKnownReposOnly = configParser.WebhookKnownOnly
+		config.CallbackSecret = configParser.CallbackSecret
+
+		if configParser.ShutdownTimeout < 0 {
+			sugarLogger.Fatalf("Invalid shutdown-timeout, expected a positive duration")
+		}
+
+		if configParser.ShutdownTimeout > 0 {
+			config.ShutdownTimeout = configParser.ShutdownTimeout
+		}
+
+		for name, timeout := range configParser.PhaseTimeouts {
+			switch phase := jobs.Phase(name); phase {
+			case jobs.PhaseValidating, jobs.PhaseFetching, jobs.PhaseWalkingAuthors, jobs.PhasePivotingAuthors, jobs.PhaseInsertingCommits:
+				if timeout < 0 {
+					sugarLogger.Fatalf("Invalid timeout for phase %s, expected a positive duration", name)
+				}
+
+				config.PhaseTimeouts[phase] = timeout
+			default:
+				sugarLogger.Fatalf("Invalid phase %s in phase-timeouts, expected one of: validating, fetching, walking_authors, pivoting_authors, inserting_commits", name)
+			}
+		}
+
 		sugarLogger.Infof("Configuration for server was set using yaml file")
 	}
 
@@ -123,6 +237,6 @@ func main() {
 		sugarLogger.Fatal("must specify the GIT_PROVIDER env variable (i.e. cache, memory)")
 	}
 
-	pizzaOvenServer := server.NewPizzaOvenServer(pizzaOven, pizzaGitProvider, sugarLogger)
+	pizzaOvenServer := server.NewPizzaOvenServer(pizzaOven, pizzaGitProvider, config, sugarLogger)
 	pizzaOvenServer.Run(serverPort)
 }
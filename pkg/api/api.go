@@ -0,0 +1,175 @@
+// package api provides the data structures returned by the read routes of the
+// pizza oven service and the cursors used to paginate through them.
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultPageLimit is the number of items returned in a page when no
+	// limit is requested
+	DefaultPageLimit = 50
+
+	// MaxPageLimit is the maximum number of items returned in a page
+	MaxPageLimit = 500
+)
+
+// Repo represents a baked git repository. The last indexed hash is the HEAD
+// of the repo when it was last baked.
+type Repo struct {
+	ID              int        `json:"id"`
+	URL             string     `json:"url"`
+	LastIndexedHash string     `json:"last_indexed_hash,omitempty"`
+	LastIndexedAt   *time.Time `json:"last_indexed_at,omitempty"`
+	CommitCount     int64      `json:"commit_count"`
+}
+
+// Author represents the canonical identity of a commit author
+type Author struct {
+	ID    int    `json:"id"`
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+// Commit represents an indexed commit of a baked repo. The line and file
+// change statistics are only set if they were collected when baking.
+type Commit struct {
+	ID           int64      `json:"id"`
+	Hash         string     `json:"hash"`
+	RepoID       int        `json:"repo_id"`
+	RepoURL      string     `json:"repo_url"`
+	Author       Author     `json:"author"`
+	Committer    *Author    `json:"committer,omitempty"`
+	Date         time.Time  `json:"date"`
+	AuthorDate   *time.Time `json:"author_date,omitempty"`
+	Subject      string     `json:"subject"`
+	Message      string     `json:"message"`
+	ParentHashes []string   `json:"parent_hashes"`
+	IsMerge      bool       `json:"is_merge"`
+	Additions    *int       `json:"additions,omitempty"`
+	Deletions    *int       `json:"deletions,omitempty"`
+	FilesChanged *int       `json:"files_changed,omitempty"`
+}
+
+// RepoPage is a page of repos ordered by their id
+type RepoPage struct {
+	Repos      []Repo `json:"repos"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// CommitPage is a page of commits ordered from the most recently committed
+type CommitPage struct {
+	Commits    []Commit `json:"commits"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+// Contributor is the commit activity of an author in a repo. The share is the
+// fraction of the repo's commits, within the same date window, that were
+// authored by the contributor.
+type Contributor struct {
+	Author          Author    `json:"author"`
+	Commits         int64     `json:"commits"`
+	FirstCommitDate time.Time `json:"first_commit_date"`
+	LastCommitDate  time.Time `json:"last_commit_date"`
+	Share           float64   `json:"share"`
+}
+
+// ContributorStats are the contributors of a repo ordered from the one with
+// the most commits
+type ContributorStats struct {
+	RepoID       int           `json:"repo_id"`
+	Since        *time.Time    `json:"since,omitempty"`
+	Until        *time.Time    `json:"until,omitempty"`
+	TotalCommits int64         `json:"total_commits"`
+	Contributors []Contributor `json:"contributors"`
+}
+
+// Granularity is the size of the buckets of a commit activity time series
+type Granularity string
+
+const (
+	// GranularityDay buckets commits by the UTC day they were committed on
+	GranularityDay Granularity = "day"
+
+	// GranularityWeek buckets commits by the week, starting on monday, they
+	// were committed in
+	GranularityWeek Granularity = "week"
+
+	// GranularityMonth buckets commits by the month they were committed in
+	GranularityMonth Granularity = "month"
+
+	// GranularityYear buckets commits by the year they were committed in
+	GranularityYear Granularity = "year"
+)
+
+// Valid returns true if the granularity is one of the supported granularities
+func (g Granularity) Valid() bool {
+	switch g {
+	case GranularityDay, GranularityWeek, GranularityMonth, GranularityYear:
+		return true
+	default:
+		return false
+	}
+}
+
+// ActivityBucket is the number of reachable commits committed within a UTC
+// day, week (starting on monday), month or year starting at the given date
+type ActivityBucket struct {
+	Date    time.Time `json:"date"`
+	Commits int64     `json:"commits"`
+}
+
+// CommitActivity is the commit activity time series of a repo
+type CommitActivity struct {
+	RepoID      int              `json:"repo_id"`
+	Granularity Granularity      `json:"granularity"`
+	Buckets     []ActivityBucket `json:"buckets"`
+}
+
+// CommitFilter narrows down the commits that are listed. Zero values do not
+// filter. Only commits that are reachable in their repo are listed.
+type CommitFilter struct {
+	RepoID      int
+	AuthorID    int
+	AuthorEmail string
+	Since       *time.Time
+	Until       *time.Time
+	HashPrefix  string
+	Cursor      *Cursor
+	Limit       int
+}
+
+// Cursor is the position after the last item of a page. Commits are paginated
+// by their date and id while repos are paginated by their id alone.
+type Cursor struct {
+	Date time.Time `json:"d,omitempty"`
+	ID   int64     `json:"i"`
+}
+
+// Encode returns the cursor as an opaque string safe for use in urls
+func (c Cursor) Encode() string {
+	// Marshalling a struct of a time and an int can not fail
+	//nolint:errcheck
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor parses a cursor previously returned by Cursor.Encode
+func DecodeCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %s", err.Error())
+	}
+
+	var c Cursor
+	err = json.Unmarshal(b, &c)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %s", err.Error())
+	}
+
+	return &c, nil
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCursorEncodeAndDecode(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		cursor Cursor
+	}{
+		{
+			name:   "Commit cursor",
+			cursor: Cursor{Date: time.Date(2023, time.October, 10, 17, 24, 52, 13, time.UTC), ID: 4721},
+		},
+		{
+			name:   "Repo cursor",
+			cursor: Cursor{ID: 42},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoded, err := DecodeCursor(tt.cursor.Encode())
+			if err != nil {
+				t.Fatalf("unexpected err decoding cursor: %s", err.Error())
+			}
+
+			if !decoded.Date.Equal(tt.cursor.Date) || decoded.ID != tt.cursor.ID {
+				t.Fatalf("decoded cursor: %+v is not expected: %+v", decoded, tt.cursor)
+			}
+		})
+	}
+}
+
+func TestDecodeInvalidCursor(t *testing.T) {
+	t.Parallel()
+
+	for _, s := range []string{"not base64!", "bm90IGpzb24"} {
+		if _, err := DecodeCursor(s); err == nil {
+			t.Fatalf("expected error decoding invalid cursor %q, got none", s)
+		}
+	}
+}
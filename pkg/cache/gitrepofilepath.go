@@ -1,9 +1,14 @@
 package cache
 
 import (
+	"context"
+	"fmt"
+	"strings"
 	"sync"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
 )
 
 // GitRepoFilePath is a key / value pair with a locking mutex which represents
@@ -34,12 +39,29 @@ type GitRepoFilePath struct {
 // OpenAndFetch opens a git repository on-disk and fetches the latest changes.
 // If the git.NoErrAlreadyUpToDate error is produced, this function does not
 // return an error but, instead, continues and returns the repo.
-func (g *GitRepoFilePath) OpenAndFetch() (*git.Repository, error) {
+//
+// If allBranches is set, all remote branches and tags are fetched, even if
+// they have been rewritten, and the branches and tags that have been deleted
+// upstream are pruned. Otherwise, only the current branch is pulled.
+//
+// If the upstream history has been rewritten (i.e., force-pushed) and the
+// latest changes can not be fast-forwarded, the current branch is hard reset
+// to the fetched remote branch.
+//
+// Fetching and pulling are abandoned once the context is done.
+func (g *GitRepoFilePath) OpenAndFetch(ctx context.Context, allBranches bool) (*git.Repository, error) {
 	repo, err := git.PlainOpen(g.path)
 	if err != nil {
 		return nil, err
 	}
 
+	if allBranches {
+		err = fetchAllRefs(ctx, repo)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Get the worktree for the repository
 	w, err := repo.Worktree()
 	if err != nil {
@@ -47,7 +69,10 @@ func (g *GitRepoFilePath) OpenAndFetch() (*git.Repository, error) {
 	}
 
 	// Pull the latest changes from the origin remote and merge into the current branch
-	err = w.Pull(&git.PullOptions{})
+	err = w.PullContext(ctx, &git.PullOptions{})
+	if err == git.ErrNonFastForwardUpdate {
+		err = resetToRemoteBranch(repo, w)
+	}
 	if err != nil && err != git.NoErrAlreadyUpToDate {
 		return nil, err
 	}
@@ -55,6 +80,90 @@ func (g *GitRepoFilePath) OpenAndFetch() (*git.Repository, error) {
 	return repo, nil
 }
 
+// fetchAllRefs force fetches every branch and tag from the origin remote and
+// prunes the remote branches and tags that no longer exist upstream
+func fetchAllRefs(ctx context.Context, repo *git.Repository) error {
+	remote, err := repo.Remote(git.DefaultRemoteName)
+	if err != nil {
+		return err
+	}
+
+	err = remote.FetchContext(ctx, &git.FetchOptions{
+		RefSpecs: []config.RefSpec{config.RefSpec(fmt.Sprintf(config.DefaultFetchRefSpec, git.DefaultRemoteName))},
+		Tags:     git.AllTags,
+		Force:    true,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return err
+	}
+
+	upstreamRefs, err := remote.ListContext(ctx, &git.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	upstream := make(map[plumbing.ReferenceName]bool, len(upstreamRefs))
+	for _, ref := range upstreamRefs {
+		upstream[ref.Name()] = true
+	}
+
+	refs, err := repo.References()
+	if err != nil {
+		return err
+	}
+
+	stale := []plumbing.ReferenceName{}
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		name := ref.Name()
+		if ref.Type() != plumbing.HashReference {
+			return nil
+		}
+
+		switch {
+		case name.IsTag() && !upstream[name]:
+			stale = append(stale, name)
+		case name.IsRemote():
+			branch := strings.TrimPrefix(name.String(), plumbing.NewRemoteReferenceName(git.DefaultRemoteName, "").String())
+			if branch != name.String() && !upstream[plumbing.NewBranchReferenceName(branch)] {
+				stale = append(stale, name)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, name := range stale {
+		err = repo.Storer.RemoveReference(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resetToRemoteBranch hard resets the current branch of the repo to the
+// already fetched remote branch of the same name on the origin remote
+func resetToRemoteBranch(repo *git.Repository, w *git.Worktree) error {
+	head, err := repo.Head()
+	if err != nil {
+		return err
+	}
+
+	remoteRef, err := repo.Reference(plumbing.NewRemoteReferenceName(git.DefaultRemoteName, head.Name().Short()), true)
+	if err != nil {
+		return err
+	}
+
+	return w.Reset(&git.ResetOptions{
+		Commit: remoteRef.Hash(),
+		Mode:   git.HardReset,
+	})
+}
+
 // Done is a thin wrapper for unlocking the GitRepoFilePath's mutex.
 // This should ALWAYS be called when operations and processing for this
 // individual on-disk repo are completed in order to prevent a deadlock.
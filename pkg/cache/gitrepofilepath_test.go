@@ -1,6 +1,14 @@
 package cache
 
-import "testing"
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
 
 func TestOpenAndFetch(t *testing.T) {
 	tests := []struct {
@@ -32,7 +40,7 @@ func TestOpenAndFetch(t *testing.T) {
 
 			// Populate the cache with the repos
 			for _, repo := range tt.repos {
-				repoFp, err := c.Put(repo)
+				repoFp, err := c.Put(context.Background(), repo, false)
 				if err != nil {
 					t.Fatalf("unexpected err putting to cache: %s", err.Error())
 				}
@@ -45,10 +53,230 @@ func TestOpenAndFetch(t *testing.T) {
 			defer repoFp.Done()
 
 			// Open and fetch the repo ensuring a non-nil git repo is returned
-			openedRepo, err := repoFp.OpenAndFetch()
+			openedRepo, err := repoFp.OpenAndFetch(context.Background(), false)
 			if openedRepo == nil || err != nil {
 				t.Fatalf("Opened repo unexpectedly failed to open and/or fetch: %s", err.Error())
 			}
 		})
 	}
 }
+
+func TestOpenAndFetchRewrittenHistory(t *testing.T) {
+	// Create an "upstream" repo on disk to clone into the cache
+	upstreamDir := t.TempDir()
+	upstream, err := git.PlainInit(upstreamDir, false)
+	if err != nil {
+		t.Fatalf("unexpected err initializing upstream repo: %s", err.Error())
+	}
+
+	w, err := upstream.Worktree()
+	if err != nil {
+		t.Fatalf("unexpected err getting upstream worktree: %s", err.Error())
+	}
+
+	commit := func(msg string, parents ...plumbing.Hash) plumbing.Hash {
+		signature := &object.Signature{Name: "Pizza Tester", Email: "tester@opensauced.pizza", When: time.Now()}
+		hash, err := w.Commit(msg, &git.CommitOptions{
+			AllowEmptyCommits: true,
+			Author:            signature,
+			Committer:         signature,
+			Parents:           parents,
+		})
+		if err != nil {
+			t.Fatalf("unexpected err committing to upstream repo: %s", err.Error())
+		}
+
+		return hash
+	}
+
+	root := commit("root")
+	commit("original")
+
+	c, err := NewGitRepoLRUCache(t.TempDir(), 1, map[string]bool{})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err.Error())
+	}
+
+	repoFp, err := c.Put(context.Background(), upstreamDir, false)
+	if err != nil {
+		t.Fatalf("unexpected err putting to cache: %s", err.Error())
+	}
+	repoFp.Done()
+
+	// Rewrite the upstream history, replacing the original commit
+	err = w.Reset(&git.ResetOptions{Commit: root, Mode: git.HardReset})
+	if err != nil {
+		t.Fatalf("unexpected err resetting upstream repo: %s", err.Error())
+	}
+	rewritten := commit("rewritten", root)
+
+	repoFp = c.Get(upstreamDir)
+	defer repoFp.Done()
+
+	openedRepo, err := repoFp.OpenAndFetch(context.Background(), false)
+	if err != nil {
+		t.Fatalf("Opened repo unexpectedly failed to open and/or fetch: %s", err.Error())
+	}
+
+	head, err := openedRepo.Head()
+	if err != nil {
+		t.Fatalf("unexpected err getting head of opened repo: %s", err.Error())
+	}
+
+	if head.Hash() != rewritten {
+		t.Fatalf("HEAD of opened repo: %s is not the rewritten upstream HEAD: %s", head.Hash(), rewritten)
+	}
+}
+
+func TestOpenAndFetchAllRefs(t *testing.T) {
+	// Create an "upstream" repo on disk to clone into the cache
+	upstreamDir := t.TempDir()
+	upstream, err := git.PlainInit(upstreamDir, false)
+	if err != nil {
+		t.Fatalf("unexpected err initializing upstream repo: %s", err.Error())
+	}
+
+	w, err := upstream.Worktree()
+	if err != nil {
+		t.Fatalf("unexpected err getting upstream worktree: %s", err.Error())
+	}
+
+	signature := &object.Signature{Name: "Pizza Tester", Email: "tester@opensauced.pizza", When: time.Now()}
+	root, err := w.Commit("root", &git.CommitOptions{
+		AllowEmptyCommits: true,
+		Author:            signature,
+		Committer:         signature,
+	})
+	if err != nil {
+		t.Fatalf("unexpected err committing to upstream repo: %s", err.Error())
+	}
+
+	setRef := func(name plumbing.ReferenceName) {
+		err := upstream.Storer.SetReference(plumbing.NewHashReference(name, root))
+		if err != nil {
+			t.Fatalf("unexpected err setting upstream ref %s: %s", name, err.Error())
+		}
+	}
+
+	setRef(plumbing.NewBranchReferenceName("stale"))
+	setRef(plumbing.NewTagReferenceName("v0"))
+
+	c, err := NewGitRepoLRUCache(t.TempDir(), 1, map[string]bool{})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err.Error())
+	}
+
+	repoFp, err := c.Put(context.Background(), upstreamDir, true)
+	if err != nil {
+		t.Fatalf("unexpected err putting to cache: %s", err.Error())
+	}
+	repoFp.Done()
+
+	// Add and remove upstream branches and tags
+	setRef(plumbing.NewBranchReferenceName("release"))
+	setRef(plumbing.NewTagReferenceName("v1"))
+	for _, name := range []plumbing.ReferenceName{plumbing.NewBranchReferenceName("stale"), plumbing.NewTagReferenceName("v0")} {
+		err = upstream.Storer.RemoveReference(name)
+		if err != nil {
+			t.Fatalf("unexpected err removing upstream ref %s: %s", name, err.Error())
+		}
+	}
+
+	repoFp = c.Get(upstreamDir)
+	defer repoFp.Done()
+
+	openedRepo, err := repoFp.OpenAndFetch(context.Background(), true)
+	if err != nil {
+		t.Fatalf("Opened repo unexpectedly failed to open and/or fetch: %s", err.Error())
+	}
+
+	expected := map[plumbing.ReferenceName]bool{
+		plumbing.NewRemoteReferenceName(git.DefaultRemoteName, "master"):  true,
+		plumbing.NewRemoteReferenceName(git.DefaultRemoteName, "release"): true,
+		plumbing.NewRemoteReferenceName(git.DefaultRemoteName, "stale"):   false,
+		plumbing.NewTagReferenceName("v1"):                                true,
+		plumbing.NewTagReferenceName("v0"):                                false,
+	}
+
+	for name, exists := range expected {
+		_, err := openedRepo.Reference(name, false)
+		if exists && err != nil {
+			t.Fatalf("expected ref %s was not fetched: %s", name, err.Error())
+		}
+
+		if !exists && err != plumbing.ErrReferenceNotFound {
+			t.Fatalf("ref %s deleted upstream was not pruned", name)
+		}
+	}
+}
+
+func TestOpenAndFetchDefaultBranch(t *testing.T) {
+	// Create an "upstream" repo on disk to clone into the cache
+	upstreamDir := t.TempDir()
+	upstream, err := git.PlainInit(upstreamDir, false)
+	if err != nil {
+		t.Fatalf("unexpected err initializing upstream repo: %s", err.Error())
+	}
+
+	w, err := upstream.Worktree()
+	if err != nil {
+		t.Fatalf("unexpected err getting upstream worktree: %s", err.Error())
+	}
+
+	signature := &object.Signature{Name: "Pizza Tester", Email: "tester@opensauced.pizza", When: time.Now()}
+	root, err := w.Commit("root", &git.CommitOptions{
+		AllowEmptyCommits: true,
+		Author:            signature,
+		Committer:         signature,
+	})
+	if err != nil {
+		t.Fatalf("unexpected err committing to upstream repo: %s", err.Error())
+	}
+
+	for _, name := range []plumbing.ReferenceName{plumbing.NewBranchReferenceName("release"), plumbing.NewTagReferenceName("v1")} {
+		err := upstream.Storer.SetReference(plumbing.NewHashReference(name, root))
+		if err != nil {
+			t.Fatalf("unexpected err setting upstream ref %s: %s", name, err.Error())
+		}
+	}
+
+	c, err := NewGitRepoLRUCache(t.TempDir(), 1, map[string]bool{})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err.Error())
+	}
+
+	repoFp, err := c.Put(context.Background(), upstreamDir, false)
+	if err != nil {
+		t.Fatalf("unexpected err putting to cache: %s", err.Error())
+	}
+	defer repoFp.Done()
+
+	release := plumbing.NewRemoteReferenceName(git.DefaultRemoteName, "release")
+	tag := plumbing.NewTagReferenceName("v1")
+
+	// Only the default branch is cloned and fetched unless every branch is
+	// requested
+	openedRepo, err := repoFp.OpenAndFetch(context.Background(), false)
+	if err != nil {
+		t.Fatalf("Opened repo unexpectedly failed to open and/or fetch: %s", err.Error())
+	}
+
+	for _, name := range []plumbing.ReferenceName{release, tag} {
+		if _, err := openedRepo.Reference(name, false); err != plumbing.ErrReferenceNotFound {
+			t.Fatalf("ref %s was fetched for the default branch only", name)
+		}
+	}
+
+	// Repos cloned for the default branch are fetched in full once every
+	// branch is requested
+	openedRepo, err = repoFp.OpenAndFetch(context.Background(), true)
+	if err != nil {
+		t.Fatalf("Opened repo unexpectedly failed to open and/or fetch: %s", err.Error())
+	}
+
+	for _, name := range []plumbing.ReferenceName{release, tag} {
+		if _, err := openedRepo.Reference(name, false); err != nil {
+			t.Fatalf("expected ref %s was not fetched: %s", name, err.Error())
+		}
+	}
+}
@@ -2,6 +2,7 @@ package cache
 
 import (
 	"container/list"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -110,7 +111,14 @@ func (c *GitRepoLRUCache) Get(key string) *GitRepoFilePath {
 // Unlocking the cache is done manually (and not through "defer c.lock.Unlock()"
 // in order to free other threads to perform cache operations when possibly
 // lengthy git cloning operations are being performed on individual elements.
-func (c *GitRepoLRUCache) Put(key string) (*GitRepoFilePath, error) {
+//
+// Only the default branch of the repo is cloned unless allBranches is set, in
+// which case every branch and tag is cloned. Repos that are already in the
+// cache are not cloned again, see GitRepoFilePath.OpenAndFetch.
+//
+// Cloning is abandoned once the context is done, in which case the partially
+// cloned repo is removed from disk and from the cache.
+func (c *GitRepoLRUCache) Put(ctx context.Context, key string, allBranches bool) (*GitRepoFilePath, error) {
 	c.lock.Lock()
 
 	if element, ok := c.hm[key]; ok {
@@ -183,12 +191,18 @@ func (c *GitRepoLRUCache) Put(key string) (*GitRepoFilePath, error) {
 	}
 
 	// Clone the new repo to disk
-	_, err = git.PlainClone(pathKey, false, &git.CloneOptions{
-		URL:  key,
-		Tags: git.NoTags,
+	tags := git.NoTags
+	if allBranches {
+		tags = git.AllTags
+	}
+
+	_, err = git.PlainCloneContext(ctx, pathKey, false, &git.CloneOptions{
+		URL:          key,
+		SingleBranch: !allBranches,
+		Tags:         tags,
 	})
 	if err != nil {
-		element.lock.Unlock()
+		c.discard(element)
 		return nil, fmt.Errorf("could not clone into cache directory: %s", err.Error())
 	}
 
@@ -197,6 +211,65 @@ func (c *GitRepoLRUCache) Put(key string) (*GitRepoFilePath, error) {
 	return element, nil
 }
 
+// discard removes a locked element whose repo could not be cloned from disk
+// and from the GitRepoLRUCache so that the next "Put" clones it from scratch.
+//
+// The element is unlocked before the cache is locked since "Get" holds the
+// cache lock while it waits on an element.
+func (c *GitRepoLRUCache) discard(element *GitRepoFilePath) {
+	os.RemoveAll(element.path)
+	element.lock.Unlock()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if listElement, ok := c.hm[element.key]; ok && listElement.Value.(*GitRepoFilePath) == element {
+		delete(c.hm, element.key)
+		c.dll.Remove(listElement)
+	}
+}
+
+// Evict removes the element for the provided key from the GitRepoLRUCache and
+// deletes its git repo from disk. If the element is being processed, Evict
+// waits until it is done without holding the cache lock, so other elements
+// may be processed in the meantime. Repos left on disk from before a restart,
+// which are not yet in the cache, are deleted as well.
+func (c *GitRepoLRUCache) Evict(key string) error {
+	c.lock.Lock()
+
+	path := filepath.Join(c.dir, key)
+	element, ok := c.hm[key]
+	if ok {
+		path = element.Value.(*GitRepoFilePath).path
+		delete(c.hm, key)
+		c.dll.Remove(element)
+	}
+
+	c.lock.Unlock()
+
+	if ok {
+		// Wait for any processing of the element to complete. The element is
+		// never unlocked since it is no longer reachable through the cache.
+		element.Value.(*GitRepoFilePath).lock.Lock()
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// The repo may have been put back into the cache while waiting on the
+	// element, in which case its repo on disk now belongs to the new element
+	if _, ok := c.hm[key]; ok {
+		return nil
+	}
+
+	err := os.RemoveAll(path)
+	if err != nil {
+		return fmt.Errorf("could not remove repo from disk: %s", err.Error())
+	}
+
+	return nil
+}
+
 // tryEvict calculates the available bytes, compares that to the cache's
 // minFreeDiskGb field and evicts the least recently used elements until
 // there is enough free disk space.
@@ -1,9 +1,15 @@
 package cache
 
 import (
+	"context"
 	"os"
+	"path/filepath"
 	"sync"
 	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
 )
 
 // These tests require at least 1 Gb free disk space to work correctly.
@@ -155,7 +161,7 @@ func TestPutGitRepoLRUCache(t *testing.T) {
 			}
 
 			for _, repo := range tt.repos {
-				repoFp, err := c.Put(repo)
+				repoFp, err := c.Put(context.Background(), repo, false)
 				if err != nil {
 					t.Fatalf("unexpected err putting to cache: %s", err.Error())
 				}
@@ -198,7 +204,7 @@ func TestTryEvict(t *testing.T) {
 			}
 
 			for _, repo := range tt.repos {
-				repoFp, err := c.Put(repo)
+				repoFp, err := c.Put(context.Background(), repo, false)
 				if err != nil {
 					t.Fatalf("unexpected err putting to cache: %s", err.Error())
 				}
@@ -285,7 +291,7 @@ func TestGetGitRepoLRUCache(t *testing.T) {
 			}
 
 			for _, repo := range tt.loadToCache {
-				repoFp, err := c.Put(repo)
+				repoFp, err := c.Put(context.Background(), repo, false)
 				if err != nil {
 					t.Fatalf("unexpected err putting to cache: %s", err.Error())
 				}
@@ -365,7 +371,7 @@ func TestGetAndPutConcurrently(t *testing.T) {
 			for _, repo := range tt.loadToCache {
 				go func(repo string, wg *sync.WaitGroup) {
 					defer wg.Done()
-					repoFp, _ := c.Put(repo)
+					repoFp, _ := c.Put(context.Background(), repo, false)
 					repoFp.lock.Unlock()
 				}(repo, &wg)
 			}
@@ -399,3 +405,187 @@ func TestGetAndPutConcurrently(t *testing.T) {
 		})
 	}
 }
+
+func TestEvict(t *testing.T) {
+	t.Parallel()
+
+	// Use "upstream" repos on disk so the test does not require network access
+	upstreamDirs := []string{t.TempDir(), t.TempDir()}
+	for _, dir := range upstreamDirs {
+		upstream, err := git.PlainInit(dir, false)
+		if err != nil {
+			t.Fatalf("unexpected err initializing upstream repo: %s", err.Error())
+		}
+
+		w, err := upstream.Worktree()
+		if err != nil {
+			t.Fatalf("unexpected err getting upstream worktree: %s", err.Error())
+		}
+
+		signature := &object.Signature{Name: "Pizza Tester", Email: "tester@opensauced.pizza", When: time.Now()}
+		_, err = w.Commit("root", &git.CommitOptions{AllowEmptyCommits: true, Author: signature, Committer: signature})
+		if err != nil {
+			t.Fatalf("unexpected err committing to upstream repo: %s", err.Error())
+		}
+	}
+
+	// Never evict repos are evicted when explicitly requested
+	c, err := NewGitRepoLRUCache(t.TempDir(), 1, map[string]bool{upstreamDirs[0]: true})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err.Error())
+	}
+
+	for _, dir := range upstreamDirs {
+		repoFp, err := c.Put(context.Background(), dir, false)
+		if err != nil {
+			t.Fatalf("unexpected err putting to cache: %s", err.Error())
+		}
+		repoFp.Done()
+	}
+
+	evictedPath := c.hm[upstreamDirs[0]].Value.(*GitRepoFilePath).path
+
+	err = c.Evict(upstreamDirs[0])
+	if err != nil {
+		t.Fatalf("unexpected err evicting repo: %s", err.Error())
+	}
+
+	validateCache(t, c, []string{upstreamDirs[1]})
+
+	if _, err := os.Stat(evictedPath); !os.IsNotExist(err) {
+		t.Fatalf("evicted repo was not removed from disk: %s", evictedPath)
+	}
+
+	// Evicting a repo that is not in the cache is not an error
+	err = c.Evict(upstreamDirs[0])
+	if err != nil {
+		t.Fatalf("unexpected err evicting missing repo: %s", err.Error())
+	}
+}
+
+func TestEvictWhileProcessing(t *testing.T) {
+	t.Parallel()
+
+	// Use "upstream" repos on disk so the test does not require network access
+	upstreamDirs := []string{t.TempDir(), t.TempDir()}
+	for _, dir := range upstreamDirs {
+		upstream, err := git.PlainInit(dir, false)
+		if err != nil {
+			t.Fatalf("unexpected err initializing upstream repo: %s", err.Error())
+		}
+
+		w, err := upstream.Worktree()
+		if err != nil {
+			t.Fatalf("unexpected err getting upstream worktree: %s", err.Error())
+		}
+
+		signature := &object.Signature{Name: "Pizza Tester", Email: "tester@opensauced.pizza", When: time.Now()}
+		_, err = w.Commit("root", &git.CommitOptions{AllowEmptyCommits: true, Author: signature, Committer: signature})
+		if err != nil {
+			t.Fatalf("unexpected err committing to upstream repo: %s", err.Error())
+		}
+	}
+
+	c, err := NewGitRepoLRUCache(t.TempDir(), 1, map[string]bool{})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err.Error())
+	}
+
+	processing, err := c.Put(context.Background(), upstreamDirs[0], false)
+	if err != nil {
+		t.Fatalf("unexpected err putting to cache: %s", err.Error())
+	}
+
+	other, err := c.Put(context.Background(), upstreamDirs[1], false)
+	if err != nil {
+		t.Fatalf("unexpected err putting to cache: %s", err.Error())
+	}
+	other.Done()
+
+	evicted := make(chan error)
+	go func() {
+		evicted <- c.Evict(upstreamDirs[0])
+	}()
+
+	// Other elements may be used while the eviction waits on the element
+	// being processed
+	gotten := make(chan *GitRepoFilePath)
+	go func() {
+		gotten <- c.Get(upstreamDirs[1])
+	}()
+
+	select {
+	case repoFp := <-gotten:
+		repoFp.Done()
+	case <-time.After(5 * time.Second):
+		t.Fatalf("get was blocked by the eviction of an element being processed")
+	}
+
+	select {
+	case err := <-evicted:
+		t.Fatalf("eviction did not wait for the element being processed: %v", err)
+	default:
+	}
+
+	processing.Done()
+	if err := <-evicted; err != nil {
+		t.Fatalf("unexpected err evicting repo: %s", err.Error())
+	}
+
+	validateCache(t, c, []string{upstreamDirs[1]})
+
+	if _, err := os.Stat(processing.path); !os.IsNotExist(err) {
+		t.Fatalf("evicted repo was not removed from disk: %s", processing.path)
+	}
+}
+
+func TestPutCancelled(t *testing.T) {
+	t.Parallel()
+
+	// Use an "upstream" repo on disk so the test does not require network access
+	upstreamDir := t.TempDir()
+	upstream, err := git.PlainInit(upstreamDir, false)
+	if err != nil {
+		t.Fatalf("unexpected err initializing upstream repo: %s", err.Error())
+	}
+
+	w, err := upstream.Worktree()
+	if err != nil {
+		t.Fatalf("unexpected err getting upstream worktree: %s", err.Error())
+	}
+
+	signature := &object.Signature{Name: "Pizza Tester", Email: "tester@opensauced.pizza", When: time.Now()}
+	_, err = w.Commit("root", &git.CommitOptions{AllowEmptyCommits: true, Author: signature, Committer: signature})
+	if err != nil {
+		t.Fatalf("unexpected err committing to upstream repo: %s", err.Error())
+	}
+
+	c, err := NewGitRepoLRUCache(t.TempDir(), 1, map[string]bool{})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err.Error())
+	}
+
+	// A cancelled clone leaves nothing behind in the cache or on disk
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = c.Put(ctx, upstreamDir, false)
+	if err == nil {
+		t.Fatalf("expected err putting to cache with a cancelled context")
+	}
+
+	validateCache(t, c, []string{})
+
+	if _, err := os.Stat(filepath.Join(c.dir, upstreamDir)); !os.IsNotExist(err) {
+		t.Fatalf("cancelled clone was not removed from disk: %s", upstreamDir)
+	}
+
+	// The repo is cloned from scratch by the next put
+	repoFp, err := c.Put(context.Background(), upstreamDir, false)
+	if err != nil {
+		t.Fatalf("unexpected err putting to cache: %s", err.Error())
+	}
+	repoFp.Done()
+
+	validateCache(t, c, []string{upstreamDir})
+}
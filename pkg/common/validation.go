@@ -1,6 +1,7 @@
 package common
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 	"strings"
@@ -14,8 +15,8 @@ import (
 // git repository. This is equivalent to running "git ls-remote" on the provided
 // URL string. This may result in some unexpected "authentication required" or
 // "repository not found" errors which is standard for git to return in these
-// situations.
-func IsValidGitRepo(repoURL string) (bool, error) {
+// situations. Listing the remote is abandoned once the context is done.
+func IsValidGitRepo(ctx context.Context, repoURL string) (bool, error) {
 	remoteConfig := &config.RemoteConfig{
 		Name: "source",
 		URLs: []string{
@@ -25,7 +26,7 @@ func IsValidGitRepo(repoURL string) (bool, error) {
 
 	remote := git.NewRemote(memory.NewStorage(), remoteConfig)
 
-	_, err := remote.List(&git.ListOptions{})
+	_, err := remote.ListContext(ctx, &git.ListOptions{})
 	if err != nil {
 		return false, fmt.Errorf("could not list remote repository: %s", err.Error())
 	}
@@ -56,5 +57,10 @@ func NormalizeGitURL(repoURL string) (string, error) {
 
 	parsedURL.Path = trimmedPath
 
+	// Hosts are case insensitive so differently cased URLs of the same repo
+	// are baked, and coalesced, as one
+	// Example: https://GitHub.com/open-sauced/pizza to https://github.com/open-sauced/pizza
+	parsedURL.Host = strings.ToLower(parsedURL.Host)
+
 	return parsedURL.String(), nil
 }
@@ -25,6 +25,11 @@ func TestNormalizeGitURL(t *testing.T) {
 			url:      "https://github.com/user/repo/",
 			expected: "https://github.com/user/repo",
 		},
+		{
+			name:     "Lowercases host",
+			url:      "https://GitHub.com/user/repo",
+			expected: "https://github.com/user/repo",
+		},
 	}
 
 	for _, tt := range tests {
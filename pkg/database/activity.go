@@ -0,0 +1,132 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/open-sauced/pizza/oven/pkg/api"
+)
+
+// activityDateLayout is the layout of the days of the commit activity rollup
+const activityDateLayout = "2006-01-02"
+
+// RefreshCommitActivity recounts the reachable commits of the given repoID on
+// the given UTC days into the daily commit activity rollup within the
+// provided transaction. Days without any reachable commits are removed.
+func (p PizzaOvenDbHandler) RefreshCommitActivity(ctx context.Context, txn *sql.Tx, repoID int, days []time.Time) error {
+	if len(days) == 0 {
+		return nil
+	}
+
+	first, last := days[0], days[0]
+	dates := make([]string, 0, len(days))
+	for _, day := range days {
+		if day.Before(first) {
+			first = day
+		}
+
+		if day.After(last) {
+			last = day
+		}
+
+		dates = append(dates, day.Format(activityDateLayout))
+	}
+
+	_, err := txn.ExecContext(ctx, "DELETE FROM public.commit_activity_daily WHERE baked_repo_id=$1 AND activity_date = ANY($2::date[])", repoID, pq.Array(dates))
+	if err != nil {
+		return err
+	}
+
+	// The commit date range bounds the scan to the repo's commits within the
+	// refreshed days
+	_, err = txn.ExecContext(ctx, `
+		INSERT INTO public.commit_activity_daily (baked_repo_id, activity_date, commit_count)
+		SELECT baked_repo_id, (commit_date AT TIME ZONE 'UTC')::date, count(*)
+		FROM public.commits
+		WHERE baked_repo_id=$1
+			AND unreachable_at IS NULL
+			AND commit_date>=$2 AND commit_date<$3
+			AND (commit_date AT TIME ZONE 'UTC')::date = ANY($4::date[])
+		GROUP BY 1, 2
+	`, repoID, first, last.AddDate(0, 0, 1), pq.Array(dates))
+	return err
+}
+
+// RebuildCommitActivity recounts every day of the daily commit activity
+// rollup of the given repoID within the provided transaction
+func (p PizzaOvenDbHandler) RebuildCommitActivity(ctx context.Context, txn *sql.Tx, repoID int) error {
+	_, err := txn.ExecContext(ctx, "DELETE FROM public.commit_activity_daily WHERE baked_repo_id=$1", repoID)
+	if err != nil {
+		return err
+	}
+
+	_, err = txn.ExecContext(ctx, `
+		INSERT INTO public.commit_activity_daily (baked_repo_id, activity_date, commit_count)
+		SELECT baked_repo_id, (commit_date AT TIME ZONE 'UTC')::date, count(*)
+		FROM public.commits
+		WHERE baked_repo_id=$1 AND unreachable_at IS NULL
+		GROUP BY 1, 2
+	`, repoID)
+	return err
+}
+
+// GetCommitActivity sums the daily commit activity rollup of the given repoID
+// into buckets of the given granularity. Buckets without commits between the
+// first and last bucket are included with a count of zero. The since and until
+// days are inclusive and default to the first and last days with commits.
+func (p PizzaOvenDbHandler) GetCommitActivity(ctx context.Context, repoID int, granularity api.Granularity, since *time.Time, until *time.Time) ([]api.ActivityBucket, error) {
+	var sinceDate, untilDate *string
+	if since != nil {
+		s := since.UTC().Format(activityDateLayout)
+		sinceDate = &s
+	}
+
+	if until != nil {
+		s := until.UTC().Format(activityDateLayout)
+		untilDate = &s
+	}
+
+	rows, err := p.db.QueryContext(ctx, `
+		WITH bounds AS (
+			SELECT
+				date_trunc($2::text, coalesce($3::date, min(activity_date))::timestamp) AS first_bucket,
+				date_trunc($2::text, coalesce($4::date, max(activity_date))::timestamp) AS last_bucket
+			FROM public.commit_activity_daily
+			WHERE baked_repo_id=$1
+		),
+		buckets AS (
+			SELECT generate_series(first_bucket, last_bucket, ('1 ' || $2::text)::interval) AS bucket
+			FROM bounds
+		)
+		SELECT b.bucket, coalesce(sum(a.commit_count), 0)
+		FROM buckets b
+		LEFT JOIN public.commit_activity_daily a
+			ON a.baked_repo_id=$1
+			AND date_trunc($2::text, a.activity_date::timestamp)=b.bucket
+			AND ($3::date IS NULL OR a.activity_date>=$3::date)
+			AND ($4::date IS NULL OR a.activity_date<=$4::date)
+		GROUP BY b.bucket
+		ORDER BY b.bucket
+	`, repoID, string(granularity), sinceDate, untilDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	buckets := []api.ActivityBucket{}
+	for rows.Next() {
+		var bucket api.ActivityBucket
+		err := rows.Scan(&bucket.Date, &bucket.Commits)
+		if err != nil {
+			return nil, err
+		}
+
+		bucket.Date = bucket.Date.UTC()
+		buckets = append(buckets, bucket)
+	}
+
+	return buckets, rows.Err()
+}
@@ -0,0 +1,280 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/open-sauced/pizza/oven/pkg/api"
+)
+
+// ListRepositories queries a page of baked repos ordered by their id along with
+// the number of their reachable commits
+func (p PizzaOvenDbHandler) ListRepositories(ctx context.Context, cursor *api.Cursor, limit int) (*api.RepoPage, error) {
+	afterID := int64(0)
+	if cursor != nil {
+		afterID = cursor.ID
+	}
+
+	// One more repo than the limit is queried to know if there is a next page
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT r.id, r.clone_url, r.last_indexed_hash, r.last_indexed_at,
+			(SELECT count(*) FROM public.commits c WHERE c.baked_repo_id=r.id AND c.unreachable_at IS NULL)
+		FROM public.baked_repos r
+		WHERE r.id > $1
+		ORDER BY r.id
+		LIMIT $2
+	`, afterID, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &api.RepoPage{Repos: []api.Repo{}}
+	for rows.Next() {
+		var repo api.Repo
+		var lastIndexedHash sql.NullString
+		var lastIndexedAt sql.NullTime
+		err := rows.Scan(&repo.ID, &repo.URL, &lastIndexedHash, &lastIndexedAt, &repo.CommitCount)
+		if err != nil {
+			return nil, err
+		}
+
+		repo.LastIndexedHash = lastIndexedHash.String
+		if lastIndexedAt.Valid {
+			repo.LastIndexedAt = &lastIndexedAt.Time
+		}
+
+		page.Repos = append(page.Repos, repo)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Repos) > limit {
+		page.Repos = page.Repos[:limit]
+		page.NextCursor = api.Cursor{ID: int64(page.Repos[limit-1].ID)}.Encode()
+	}
+
+	return page, nil
+}
+
+// GetAuthor queries a commit author by their id
+func (p PizzaOvenDbHandler) GetAuthor(ctx context.Context, authorID int) (*api.Author, error) {
+	var author api.Author
+	var name sql.NullString
+	err := p.db.QueryRowContext(ctx, "SELECT id, commit_author_email, commit_author_name FROM public.commit_authors WHERE id=$1", authorID).
+		Scan(&author.ID, &author.Email, &name)
+	if err != nil {
+		return nil, err
+	}
+
+	author.Name = name.String
+	return &author, nil
+}
+
+// ListCommits queries a page of reachable commits matching the given filter,
+// ordered from the most recently committed
+func (p PizzaOvenDbHandler) ListCommits(ctx context.Context, filter api.CommitFilter) (*api.CommitPage, error) {
+	conditions := []string{"c.unreachable_at IS NULL"}
+	args := []any{}
+	where := func(condition string, values ...any) {
+		placeholders := make([]any, 0, len(values))
+		for _, value := range values {
+			args = append(args, value)
+			placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+		}
+
+		conditions = append(conditions, fmt.Sprintf(condition, placeholders...))
+	}
+
+	if filter.RepoID != 0 {
+		where("c.baked_repo_id=%s", filter.RepoID)
+	}
+
+	if filter.AuthorID != 0 {
+		where("c.commit_author_id=%s", filter.AuthorID)
+	}
+
+	if filter.AuthorEmail != "" {
+		where("a.commit_author_email=%s", filter.AuthorEmail)
+	}
+
+	if filter.Since != nil {
+		where("c.commit_date>=%s", *filter.Since)
+	}
+
+	if filter.Until != nil {
+		where("c.commit_date<=%s", *filter.Until)
+	}
+
+	if filter.HashPrefix != "" {
+		where("c.commit_hash LIKE %s", filter.HashPrefix+"%")
+	}
+
+	if filter.Cursor != nil {
+		where("(c.commit_date, c.id) < (%s, %s)", filter.Cursor.Date, filter.Cursor.ID)
+	}
+
+	// One more commit than the limit is queried to know if there is a next page
+	args = append(args, filter.Limit+1)
+	rows, err := p.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT c.id, c.commit_hash, c.baked_repo_id, r.clone_url, c.commit_date, c.commit_author_date,
+			a.id, a.commit_author_email, a.commit_author_name,
+			cm.id, cm.commit_author_email, cm.commit_author_name,
+			c.commit_subject, c.commit_message, c.commit_parent_hashes, c.commit_is_merge,
+			c.commit_additions, c.commit_deletions, c.commit_files_changed
+		FROM public.commits c
+		JOIN public.baked_repos r ON r.id=c.baked_repo_id
+		JOIN public.commit_authors a ON a.id=c.commit_author_id
+		LEFT JOIN public.commit_authors cm ON cm.id=c.commit_committer_id
+		WHERE %s
+		ORDER BY c.commit_date DESC, c.id DESC
+		LIMIT $%d
+	`, strings.Join(conditions, " AND "), len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &api.CommitPage{Commits: []api.Commit{}}
+	for rows.Next() {
+		commit, err := scanCommit(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		page.Commits = append(page.Commits, *commit)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Commits) > filter.Limit {
+		page.Commits = page.Commits[:filter.Limit]
+		last := page.Commits[filter.Limit-1]
+		page.NextCursor = api.Cursor{Date: last.Date, ID: last.ID}.Encode()
+	}
+
+	return page, nil
+}
+
+// GetContributorStats aggregates the reachable commits of a repo per author
+// within an optional date window
+func (p PizzaOvenDbHandler) GetContributorStats(ctx context.Context, repoID int, since *time.Time, until *time.Time) (*api.ContributorStats, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		WITH contributors AS (
+			SELECT commit_author_id, count(*) AS commits, min(commit_date) AS first_commit_date, max(commit_date) AS last_commit_date
+			FROM public.commits
+			WHERE baked_repo_id=$1
+				AND unreachable_at IS NULL
+				AND ($2::timestamptz IS NULL OR commit_date>=$2)
+				AND ($3::timestamptz IS NULL OR commit_date<=$3)
+			GROUP BY commit_author_id
+		)
+		SELECT a.id, a.commit_author_email, a.commit_author_name,
+			c.commits, c.first_commit_date, c.last_commit_date,
+			sum(c.commits) OVER ()
+		FROM contributors c
+		JOIN public.commit_authors a ON a.id=c.commit_author_id
+		ORDER BY c.commits DESC, a.id
+	`, repoID, since, until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := &api.ContributorStats{
+		RepoID:       repoID,
+		Since:        since,
+		Until:        until,
+		Contributors: []api.Contributor{},
+	}
+
+	for rows.Next() {
+		var contributor api.Contributor
+		var name sql.NullString
+		err := rows.Scan(
+			&contributor.Author.ID, &contributor.Author.Email, &name,
+			&contributor.Commits, &contributor.FirstCommitDate, &contributor.LastCommitDate,
+			&stats.TotalCommits,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		contributor.Author.Name = name.String
+		contributor.Share = float64(contributor.Commits) / float64(stats.TotalCommits)
+		stats.Contributors = append(stats.Contributors, contributor)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// scanCommit scans a commit queried by ListCommits
+func scanCommit(row rowScanner) (*api.Commit, error) {
+	var commit api.Commit
+	var authorDate sql.NullTime
+	var authorName, subject, message sql.NullString
+	var committerID sql.NullInt64
+	var committerEmail, committerName sql.NullString
+	var parentHashes pq.StringArray
+	var additions, deletions, filesChanged sql.NullInt64
+
+	err := row.Scan(
+		&commit.ID, &commit.Hash, &commit.RepoID, &commit.RepoURL, &commit.Date, &authorDate,
+		&commit.Author.ID, &commit.Author.Email, &authorName,
+		&committerID, &committerEmail, &committerName,
+		&subject, &message, &parentHashes, &commit.IsMerge,
+		&additions, &deletions, &filesChanged,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	commit.Author.Name = authorName.String
+	commit.Subject = subject.String
+	commit.Message = message.String
+	commit.ParentHashes = []string(parentHashes)
+	if commit.ParentHashes == nil {
+		commit.ParentHashes = []string{}
+	}
+
+	if authorDate.Valid {
+		commit.AuthorDate = &authorDate.Time
+	}
+
+	if committerID.Valid {
+		commit.Committer = &api.Author{
+			ID:    int(committerID.Int64),
+			Email: committerEmail.String,
+			Name:  committerName.String,
+		}
+	}
+
+	commit.Additions = nullIntPtr(additions)
+	commit.Deletions = nullIntPtr(deletions)
+	commit.FilesChanged = nullIntPtr(filesChanged)
+
+	return &commit, nil
+}
+
+// nullIntPtr returns a pointer to the value of a nullable int or nil if null
+func nullIntPtr(n sql.NullInt64) *int {
+	if !n.Valid {
+		return nil
+	}
+
+	v := int(n.Int64)
+	return &v
+}
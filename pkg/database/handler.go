@@ -4,10 +4,10 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
-	"time"
 
 	// the injected postgres interface implementations for Go SQL
 	"github.com/lib/pq"
@@ -44,125 +44,278 @@ func NewPizzaOvenDbHandler(host, port, user, pwd, dbName, sslmode string) *Pizza
 	}
 }
 
+// Close closes the database connection pool. Connections that are in use
+// are closed once they are returned to the pool, which drops the session's
+// temporary tables and releases its advisory locks.
+func (p PizzaOvenDbHandler) Close() error {
+	return p.db.Close()
+}
+
 // GetRepositoryID queries the id of a repository based on its git URL
-func (p PizzaOvenDbHandler) GetRepositoryID(insight insights.CommitInsight) (int, error) {
+func (p PizzaOvenDbHandler) GetRepositoryID(ctx context.Context, insight insights.CommitInsight) (int, error) {
 	var id int
-	err := p.db.QueryRow("SELECT id FROM public.baked_repos WHERE clone_url=$1", insight.RepoURLSource).Scan(&id)
+	err := p.db.QueryRowContext(ctx, "SELECT id FROM public.baked_repos WHERE clone_url=$1", insight.RepoURLSource).Scan(&id)
 	return id, err
 }
 
-// InsertRepository inserts a git repository by its git_url
-func (p PizzaOvenDbHandler) InsertRepository(insight insights.CommitInsight) (int, error) {
+// InsertRepository inserts a git repository by its git_url. If the repository
+// was already inserted, i.e. by a concurrent bake of it, its id is returned.
+func (p PizzaOvenDbHandler) InsertRepository(ctx context.Context, insight insights.CommitInsight) (int, error) {
 	var id int
-	err := p.db.QueryRow("INSERT INTO public.baked_repos(clone_url) VALUES($1) RETURNING id", insight.RepoURLSource).Scan(&id)
+	err := p.db.QueryRowContext(ctx, `
+		INSERT INTO public.baked_repos(clone_url) VALUES($1)
+		ON CONFLICT (clone_url) DO UPDATE SET clone_url=EXCLUDED.clone_url
+		RETURNING id`,
+		insight.RepoURLSource,
+	).Scan(&id)
 	return id, err
 }
 
 // GetAuthorID queries the id of an author by their email
-func (p PizzaOvenDbHandler) GetAuthorID(insight insights.CommitInsight) (int, error) {
+func (p PizzaOvenDbHandler) GetAuthorID(ctx context.Context, insight insights.CommitInsight) (int, error) {
 	var id int
-	err := p.db.QueryRow("SELECT id FROM public.commit_authors WHERE commit_author_email=$1", insight.AuthorEmail).Scan(&id)
+	err := p.db.QueryRowContext(ctx, "SELECT id FROM public.commit_authors WHERE commit_author_email=$1", insight.AuthorEmail).Scan(&id)
 	return id, err
 }
 
 // GetAuthorIDs queries the id of an author by their email
-func (p PizzaOvenDbHandler) GetAuthorIDs(emails []string) (map[string]int, error) {
+func (p PizzaOvenDbHandler) GetAuthorIDs(ctx context.Context, emails []string) (map[string]int, error) {
 	emailIDMap := make(map[string]int)
 
-	rows, err := p.db.Query("SELECT id, commit_author_email FROM commit_authors WHERE commit_author_email = ANY($1);", pq.Array(emails))
+	rows, err := p.db.QueryContext(ctx, "SELECT id, commit_author_email FROM commit_authors WHERE commit_author_email = ANY($1);", pq.Array(emails))
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	defer rows.Close()
 	for rows.Next() {
 		var id int
 		var email string
 		if err := rows.Scan(&id, &email); err != nil {
-			log.Fatal(err)
+			return nil, err
 		}
 		emailIDMap[email] = id
 	}
 
-	return emailIDMap, nil
+	return emailIDMap, rows.Err()
 }
 
-// PrepareBulkAuthorInsert creates a temporary table that mirrors the commit_authors
-// and is used to perform a bulk insert "pivot" which accounts for conflicts
-func (p PizzaOvenDbHandler) PrepareBulkAuthorInsert(tmpTableName string) (*sql.Tx, *sql.Stmt, error) {
-	_, err := p.db.Exec(fmt.Sprintf("CREATE TEMPORARY TABLE %s AS SELECT * FROM commit_authors WHERE 1=0", tmpTableName))
+// PrepareBulkAuthorInsert begins the transaction commit authors are inserted
+// in and creates a temporary table within it that mirrors the commit_authors
+// and commit_author_names tables. The temporary table is used to perform a
+// bulk insert "pivot" which accounts for conflicts and is dropped once the
+// transaction is resolved. See PivotTmpTableToAuthorsTable.
+//
+// The transaction is rolled back if the context is done before it is
+// committed, so the context must outlive the pivot.
+func (p PizzaOvenDbHandler) PrepareBulkAuthorInsert(ctx context.Context, tmpTableName string) (*sql.Tx, *sql.Stmt, error) {
+	txn, err := p.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	txn, err := p.db.Begin()
+	_, err = txn.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TEMPORARY TABLE %s ON COMMIT DROP AS
+		SELECT a.commit_author_email, n.commit_author_name, n.first_seen_at, n.last_seen_at
+		FROM commit_authors a, commit_author_names n WHERE 1=0
+	`, tmpTableName))
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, abortTransaction(txn, err)
 	}
 
-	stmt, err := txn.Prepare(pq.CopyIn(tmpTableName, "commit_author_email"))
+	stmt, err := txn.PrepareContext(ctx, pq.CopyIn(tmpTableName, "commit_author_email", "commit_author_name", "first_seen_at", "last_seen_at"))
 	if err != nil {
-		newErr := txn.Rollback()
-		if newErr != nil {
-			return nil, nil, fmt.Errorf("could not abort the sql transaction: %s - original error: %s", newErr, err)
-		}
-
-		return nil, nil, err
+		return nil, nil, abortTransaction(txn, err)
 	}
 
 	return txn, stmt, nil
 }
 
-// PivotTmpTableToAuthorsTable performs the pivot from the temporary commit authors
-// table to the real one handling any conflicts
-func (p PizzaOvenDbHandler) PivotTmpTableToAuthorsTable(tmpTableName string) error {
-	_, err := p.db.Exec(fmt.Sprintf(`
+// abortTransaction rolls back the transaction after it failed with the given
+// error, which is returned along with any error rolling back
+func abortTransaction(txn *sql.Tx, err error) error {
+	newErr := txn.Rollback()
+	if newErr != nil {
+		return fmt.Errorf("could not abort the sql transaction: %s - original error: %s", newErr, err)
+	}
+
+	return err
+}
+
+// PivotTmpTableToAuthorsTable executes the bulk author statement, performs the
+// pivot from the temporary commit authors table to the real one handling any
+// conflicts and commits the transaction.
+//
+// Every name seen for an author's email is recorded in the commit_author_names
+// table along with the range of time it was seen. The display name of the
+// author is the name that was most recently seen. The number of authors that
+// were new to the commit_authors table is returned.
+func (p PizzaOvenDbHandler) PivotTmpTableToAuthorsTable(ctx context.Context, txn *sql.Tx, stmt *sql.Stmt, tmpTableName string) (int64, error) {
+	_, err := stmt.ExecContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	err = stmt.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := txn.ExecContext(ctx, fmt.Sprintf(`
 		INSERT INTO public.commit_authors(commit_author_email)
-		SELECT commit_author_email FROM %s
+		SELECT DISTINCT commit_author_email FROM %s
 		ON CONFLICT (commit_author_email)
 		DO NOTHING
 	`, tmpTableName))
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	_, err = p.db.Exec(fmt.Sprintf("DROP TABLE %s", tmpTableName))
+	authorsInserted, err := result.RowsAffected()
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	_, err = txn.ExecContext(ctx, fmt.Sprintf(`
+		INSERT INTO public.commit_author_names(commit_author_id, commit_author_name, first_seen_at, last_seen_at)
+		SELECT a.id, t.commit_author_name, min(t.first_seen_at), max(t.last_seen_at) FROM %[1]s t
+		JOIN public.commit_authors a ON a.commit_author_email = t.commit_author_email
+		GROUP BY a.id, t.commit_author_name
+		ON CONFLICT (commit_author_id, commit_author_name)
+		DO UPDATE SET
+			first_seen_at = LEAST(commit_author_names.first_seen_at, EXCLUDED.first_seen_at),
+			last_seen_at = GREATEST(commit_author_names.last_seen_at, EXCLUDED.last_seen_at);
+
+		UPDATE public.commit_authors a SET commit_author_name = latest.commit_author_name
+		FROM (
+			SELECT DISTINCT ON (n.commit_author_id) n.commit_author_id, n.commit_author_name
+			FROM public.commit_author_names n
+			JOIN public.commit_authors ca ON ca.id = n.commit_author_id
+			WHERE ca.commit_author_email IN (SELECT commit_author_email FROM %[1]s)
+			ORDER BY n.commit_author_id, n.last_seen_at DESC
+		) latest
+		WHERE a.id = latest.commit_author_id;
+	`, tmpTableName))
+	if err != nil {
+		return 0, err
+	}
+
+	err = txn.Commit()
+	if err != nil {
+		return 0, err
 	}
 
-	return nil
+	return authorsInserted, nil
 }
 
-// InsertAuthor inserts an author by their email into the sql transaction
-func (p PizzaOvenDbHandler) InsertAuthor(stmt *sql.Stmt, insight insights.CommitInsight) error {
-	_, err := stmt.Exec(insight.AuthorEmail)
+// InsertAuthor inserts an author by their email and name, along with the
+// range of time they were seen, into the sql transaction
+func (p PizzaOvenDbHandler) InsertAuthor(ctx context.Context, stmt *sql.Stmt, author insights.AuthorInsight) error {
+	_, err := stmt.ExecContext(ctx, author.Email, author.Name, author.FirstSeen, author.LastSeen)
 	return err
 }
 
-// PrepareBulkCommitInsert gets a sql bulk transaction ready to insert all commits
-// from processing in one round trip
-func (p PizzaOvenDbHandler) PrepareBulkCommitInsert() (*sql.Tx, *sql.Stmt, error) {
-	txn, err := p.db.Begin()
+// BeginRepositoryTransaction begins the transaction in which the commits of a
+// repo are inserted. See PrepareBulkCommitInsert. The transaction is rolled
+// back if the context is done before it is committed.
+func (p PizzaOvenDbHandler) BeginRepositoryTransaction(ctx context.Context) (*sql.Tx, error) {
+	return p.db.BeginTx(ctx, nil)
+}
+
+// PrepareBulkCommitInsert gets a sql bulk statement ready to insert all commits
+// from processing in one round trip within the given transaction. Commits are
+// copied into a temporary table that mirrors the commits table which is
+// dropped once the transaction is resolved. See PivotTmpTableToCommitsTable.
+func (p PizzaOvenDbHandler) PrepareBulkCommitInsert(ctx context.Context, txn *sql.Tx, tmpTableName string) (*sql.Stmt, error) {
+	_, err := txn.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TEMPORARY TABLE %s ON COMMIT DROP AS
+		SELECT commit_hash, commit_author_id, commit_committer_id, commit_author_raw_email, commit_committer_raw_email,
+			baked_repo_id, commit_date, commit_author_date, commit_subject, commit_message, commit_parent_hashes, commit_is_merge
+		FROM commits WHERE 1=0
+	`, tmpTableName))
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	stmt, err := txn.Prepare(pq.CopyIn("commits", "commit_hash", "commit_author_id", "baked_repo_id", "commit_date"))
+	return txn.PrepareContext(ctx, pq.CopyIn(
+		tmpTableName,
+		"commit_hash", "commit_author_id", "commit_committer_id", "commit_author_raw_email", "commit_committer_raw_email",
+		"baked_repo_id", "commit_date", "commit_author_date", "commit_subject", "commit_message", "commit_parent_hashes", "commit_is_merge",
+	))
+}
+
+// PivotTmpTableToCommitsTable executes the bulk commit statement and performs
+// the pivot from the temporary commits table to the real one, skipping commits
+// that have already been indexed for the repo. The number of newly inserted
+// commits is returned.
+//
+// The transaction is not committed so callers may perform additional updates
+// within the same transaction before committing it.
+func (p PizzaOvenDbHandler) PivotTmpTableToCommitsTable(ctx context.Context, txn *sql.Tx, stmt *sql.Stmt, tmpTableName string) (int64, error) {
+	_, err := stmt.ExecContext(ctx)
 	if err != nil {
-		newErr := txn.Rollback()
-		if newErr != nil {
-			return nil, nil, fmt.Errorf("could not abort commits bulk sql transaction: %s - original error: %s", newErr, err)
-		}
+		return 0, err
+	}
 
-		return nil, nil, err
+	err = stmt.Close()
+	if err != nil {
+		return 0, err
 	}
 
-	return txn, stmt, nil
+	result, err := txn.ExecContext(ctx, fmt.Sprintf(`
+		INSERT INTO public.commits(
+			commit_hash, commit_author_id, commit_committer_id, commit_author_raw_email, commit_committer_raw_email,
+			baked_repo_id, commit_date, commit_author_date, commit_subject, commit_message, commit_parent_hashes, commit_is_merge
+		)
+		SELECT
+			commit_hash, commit_author_id, commit_committer_id, commit_author_raw_email, commit_committer_raw_email,
+			baked_repo_id, commit_date, commit_author_date, commit_subject, commit_message, commit_parent_hashes, commit_is_merge
+		FROM %s
+		ON CONFLICT (baked_repo_id, commit_hash)
+		DO NOTHING
+	`, tmpTableName))
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// InsertCommit adds a commit to the given sql.Stmt to be executed in bulk
+func (p PizzaOvenDbHandler) InsertCommit(ctx context.Context, stmt *sql.Stmt, insight insights.CommitInsight, authorID int, committerID int, repoID int) error {
+	_, err := stmt.ExecContext(ctx,
+		insight.Hash, authorID, committerID, insight.RawAuthorEmail, insight.RawCommitterEmail,
+		repoID, insight.Date, insight.AuthorDate, insight.Subject, insight.Message, pq.Array(insight.ParentHashes), insight.IsMerge,
+	)
+	return err
 }
 
-// ResolveTransaction resolves a given transaction and sql statement
-func (p PizzaOvenDbHandler) ResolveTransaction(txn *sql.Tx, stmt *sql.Stmt) error {
-	_, err := stmt.Exec()
+// PrepareBulkCoAuthorInsert creates a temporary table within the given
+// transaction which holds commit hashes and the ids of their co-authors and
+// gets a bulk statement ready to copy them into it
+func (p PizzaOvenDbHandler) PrepareBulkCoAuthorInsert(ctx context.Context, txn *sql.Tx, tmpTableName string) (*sql.Stmt, error) {
+	_, err := txn.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TEMPORARY TABLE %s ON COMMIT DROP AS
+		SELECT c.commit_hash, ca.commit_author_id FROM commits c, commit_coauthors ca WHERE 1=0
+	`, tmpTableName))
+	if err != nil {
+		return nil, err
+	}
+
+	return txn.PrepareContext(ctx, pq.CopyIn(tmpTableName, "commit_hash", "commit_author_id"))
+}
+
+// InsertCoAuthor adds a commit co-author to the given sql.Stmt to be executed
+// in bulk
+func (p PizzaOvenDbHandler) InsertCoAuthor(ctx context.Context, stmt *sql.Stmt, hash string, authorID int) error {
+	_, err := stmt.ExecContext(ctx, hash, authorID)
+	return err
+}
+
+// PivotTmpTableToCoAuthorsTable executes the bulk co-author statement and
+// performs the pivot from the temporary co-authors table to the real one by
+// resolving the ids of the given repoID's commits from their hashes
+func (p PizzaOvenDbHandler) PivotTmpTableToCoAuthorsTable(ctx context.Context, txn *sql.Tx, stmt *sql.Stmt, tmpTableName string, repoID int) error {
+	_, err := stmt.ExecContext(ctx)
 	if err != nil {
 		return err
 	}
@@ -172,40 +325,234 @@ func (p PizzaOvenDbHandler) ResolveTransaction(txn *sql.Tx, stmt *sql.Stmt) erro
 		return err
 	}
 
-	err = txn.Commit()
+	_, err = txn.ExecContext(ctx, fmt.Sprintf(`
+		INSERT INTO public.commit_coauthors(commit_id, commit_author_id)
+		SELECT c.id, t.commit_author_id FROM %s t
+		JOIN public.commits c ON c.baked_repo_id=$1 AND c.commit_hash=t.commit_hash
+		ON CONFLICT (commit_id, commit_author_id)
+		DO NOTHING
+	`, tmpTableName), repoID)
+
+	return err
+}
+
+// PrepareBulkFileChangeInsert creates a temporary table within the given
+// transaction which holds commit hashes and the changes made to each file in
+// those commits and gets a bulk statement ready to copy them into it
+func (p PizzaOvenDbHandler) PrepareBulkFileChangeInsert(ctx context.Context, txn *sql.Tx, tmpTableName string) (*sql.Stmt, error) {
+	_, err := txn.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TEMPORARY TABLE %s ON COMMIT DROP AS
+		SELECT c.commit_hash, f.file_path, f.previous_file_path, f.additions, f.deletions, f.change_type
+		FROM commits c, commit_file_changes f WHERE 1=0
+	`, tmpTableName))
+	if err != nil {
+		return nil, err
+	}
+
+	return txn.PrepareContext(ctx, pq.CopyIn(tmpTableName, "commit_hash", "file_path", "previous_file_path", "additions", "deletions", "change_type"))
+}
+
+// InsertFileChange adds a commit's file change to the given sql.Stmt to be
+// executed in bulk. A nil file change records a commit without any changes.
+func (p PizzaOvenDbHandler) InsertFileChange(ctx context.Context, stmt *sql.Stmt, hash string, change *insights.FileChange) error {
+	if change == nil {
+		_, err := stmt.ExecContext(ctx, hash, nil, nil, 0, 0, nil)
+		return err
+	}
+
+	previousPath := sql.NullString{String: change.PreviousPath, Valid: change.PreviousPath != ""}
+	_, err := stmt.ExecContext(ctx, hash, change.Path, previousPath, change.Additions, change.Deletions, string(change.ChangeType))
+	return err
+}
+
+// PivotTmpTableToFileChangesTable executes the bulk file change statement and
+// performs the pivot from the temporary file changes table to the real one by
+// resolving the ids of the given repoID's commits from their hashes. The
+// line and file change totals of each commit are updated from its file changes.
+func (p PizzaOvenDbHandler) PivotTmpTableToFileChangesTable(ctx context.Context, txn *sql.Tx, stmt *sql.Stmt, tmpTableName string, repoID int) error {
+	_, err := stmt.ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = stmt.Close()
 	if err != nil {
 		return err
 	}
 
-	return nil
+	_, err = txn.ExecContext(ctx, fmt.Sprintf(`
+		INSERT INTO public.commit_file_changes(commit_id, file_path, previous_file_path, additions, deletions, change_type)
+		SELECT c.id, t.file_path, t.previous_file_path, t.additions, t.deletions, t.change_type FROM %s t
+		JOIN public.commits c ON c.baked_repo_id=$1 AND c.commit_hash=t.commit_hash
+		WHERE t.file_path IS NOT NULL
+		ON CONFLICT (commit_id, file_path)
+		DO NOTHING
+	`, tmpTableName), repoID)
+	if err != nil {
+		return err
+	}
+
+	_, err = txn.ExecContext(ctx, fmt.Sprintf(`
+		UPDATE public.commits c
+		SET commit_additions=s.additions, commit_deletions=s.deletions, commit_files_changed=s.files_changed
+		FROM (
+			SELECT commit_hash, sum(additions) AS additions, sum(deletions) AS deletions, count(file_path) AS files_changed
+			FROM %s GROUP BY commit_hash
+		) s
+		WHERE c.baked_repo_id=$1 AND c.commit_hash=s.commit_hash
+	`, tmpTableName), repoID)
+
+	return err
+}
+
+// PrepareBulkReachableCommitInsert creates a temporary table within the given
+// transaction which holds the hashes of every commit reachable from a repo's
+// HEAD and gets a bulk statement ready to copy those hashes into it
+func (p PizzaOvenDbHandler) PrepareBulkReachableCommitInsert(ctx context.Context, txn *sql.Tx, tmpTableName string) (*sql.Stmt, error) {
+	_, err := txn.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TEMPORARY TABLE %s ON COMMIT DROP AS
+		SELECT commit_hash FROM commits WHERE 1=0
+	`, tmpTableName))
+	if err != nil {
+		return nil, err
+	}
+
+	return txn.PrepareContext(ctx, pq.CopyIn(tmpTableName, "commit_hash"))
 }
 
-// InsertCommit adds a commit to the given sql.Stmt to be executed in bulk
-func (p PizzaOvenDbHandler) InsertCommit(stmt *sql.Stmt, insight insights.CommitInsight, authorID int, repoID int) error {
-	_, err := stmt.Exec(insight.Hash, authorID, repoID, insight.Date)
+// InsertReachableCommit adds a reachable commit hash to the given sql.Stmt to
+// be executed in bulk
+func (p PizzaOvenDbHandler) InsertReachableCommit(ctx context.Context, stmt *sql.Stmt, hash string) error {
+	_, err := stmt.ExecContext(ctx, hash)
 	return err
 }
 
-// GetLastCommit returns time.Time of the last git commit for the given repoID
-func (p PizzaOvenDbHandler) GetLastCommit(repoID int) (time.Time, error) {
-	var dateTime sql.NullTime
-	err := p.db.QueryRow("SELECT commit_date FROM public.commits WHERE commit_date IS NOT NULL AND baked_repo_id=$1 ORDER BY commit_date DESC LIMIT 1", repoID).Scan(&dateTime)
+// ReconcileUnreachableCommits executes the bulk reachable commit statement and
+// then either deletes or marks as unreachable the commits of the given repoID
+// that are not in the temporary reachable commits table. When marking commits,
+// previously unreachable commits that are reachable again are unmarked.
+// The number of commits that were deleted or marked is returned.
+func (p PizzaOvenDbHandler) ReconcileUnreachableCommits(ctx context.Context, txn *sql.Tx, stmt *sql.Stmt, tmpTableName string, repoID int, deleteUnreachable bool) (int64, error) {
+	_, err := stmt.ExecContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	err = stmt.Close()
 	if err != nil {
-		if err == sql.ErrNoRows {
-			// When no rows are returned, use an empty time.Time struct which
-			// is "the beginning of time"
-			return time.Time{}, nil
+		return 0, err
+	}
+
+	if deleteUnreachable {
+		result, err := txn.ExecContext(ctx, fmt.Sprintf(`
+			DELETE FROM public.commits c
+			WHERE c.baked_repo_id=$1
+			AND NOT EXISTS (SELECT 1 FROM %s r WHERE r.commit_hash = c.commit_hash)
+		`, tmpTableName), repoID)
+		if err != nil {
+			return 0, err
 		}
 
-		// If it's an error for anything else, return the error
-		return time.Time{}, err
+		return result.RowsAffected()
 	}
 
-	// If the returned date / time is not valid for some reason,
-	// return an empty time struct
-	if !dateTime.Valid {
-		return time.Time{}, nil
+	result, err := txn.ExecContext(ctx, fmt.Sprintf(`
+		UPDATE public.commits c SET unreachable_at=now()
+		WHERE c.baked_repo_id=$1 AND c.unreachable_at IS NULL
+		AND NOT EXISTS (SELECT 1 FROM %s r WHERE r.commit_hash = c.commit_hash)
+	`, tmpTableName), repoID)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = txn.ExecContext(ctx, fmt.Sprintf(`
+		UPDATE public.commits c SET unreachable_at=NULL
+		WHERE c.baked_repo_id=$1 AND c.unreachable_at IS NOT NULL
+		AND EXISTS (SELECT 1 FROM %s r WHERE r.commit_hash = c.commit_hash)
+	`, tmpTableName), repoID)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// GetLastIndexedHash returns the hash of the HEAD commit of the given repoID
+// at the time it was last indexed. If the repo has not yet been indexed, an
+// empty string is returned.
+func (p PizzaOvenDbHandler) GetLastIndexedHash(ctx context.Context, repoID int) (string, error) {
+	var hash sql.NullString
+	err := p.db.QueryRowContext(ctx, "SELECT last_indexed_hash FROM public.baked_repos WHERE id=$1", repoID).Scan(&hash)
+	if err != nil {
+		return "", err
+	}
+
+	return hash.String, nil
+}
+
+// UpdateLastIndexedHash records the hash of the HEAD commit of the given repoID
+// that has been indexed within the provided transaction
+func (p PizzaOvenDbHandler) UpdateLastIndexedHash(ctx context.Context, txn *sql.Tx, repoID int, hash string) error {
+	_, err := txn.ExecContext(ctx, "UPDATE public.baked_repos SET last_indexed_hash=$2, last_indexed_at=now() WHERE id=$1", repoID, hash)
+	return err
+}
+
+// GetRepositoryURL queries the clone url of a repo by its id
+func (p PizzaOvenDbHandler) GetRepositoryURL(ctx context.Context, repoID int) (string, error) {
+	var url string
+	err := p.db.QueryRowContext(ctx, "SELECT clone_url FROM public.baked_repos WHERE id=$1", repoID).Scan(&url)
+	return url, err
+}
+
+// PurgeRepository deletes all the commits, refs and commit activity of the
+// given repoID and resets its last indexed HEAD within the provided
+// transaction so that the repo is indexed from scratch. The number of deleted
+// commits is returned.
+func (p PizzaOvenDbHandler) PurgeRepository(ctx context.Context, txn *sql.Tx, repoID int) (int64, error) {
+	_, err := txn.ExecContext(ctx, "DELETE FROM public.refs WHERE baked_repo_id=$1", repoID)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = txn.ExecContext(ctx, "DELETE FROM public.commit_activity_daily WHERE baked_repo_id=$1", repoID)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := txn.ExecContext(ctx, "DELETE FROM public.commits WHERE baked_repo_id=$1", repoID)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = txn.ExecContext(ctx, "UPDATE public.baked_repos SET last_indexed_hash=NULL, last_indexed_at=NULL WHERE id=$1", repoID)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// DeleteRepository deletes the given repoID along with all of its commits and
+// refs. The number of deleted commits is returned.
+func (p PizzaOvenDbHandler) DeleteRepository(ctx context.Context, repoID int) (int64, error) {
+	txn, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	// Rolling back is a no-op once the transaction has been committed
+	//nolint:errcheck
+	defer txn.Rollback()
+
+	commitsDeleted, err := p.PurgeRepository(ctx, txn, repoID)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = txn.ExecContext(ctx, "DELETE FROM public.baked_repos WHERE id=$1", repoID)
+	if err != nil {
+		return 0, err
 	}
 
-	return dateTime.Time, nil
+	return commitsDeleted, txn.Commit()
 }
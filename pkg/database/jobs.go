@@ -0,0 +1,357 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/open-sauced/pizza/oven/pkg/jobs"
+)
+
+// bakeJobColumns are the columns selected when scanning a bake job row via
+// scanBakeJob
+const bakeJobColumns = "id, clone_url, options, status, attempts, created_at, started_at, finished_at, commits_inserted, error, phase, phase_count, claim_id"
+
+// ErrBakeJobLost is returned when updating a job that is no longer running
+// under the claim of the worker updating it, i.e. because it was re-claimed by
+// another worker after its heartbeat went stale
+var ErrBakeJobLost = errors.New("bake job is no longer claimed by this worker")
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// maxEnqueueAttempts is the number of times InsertBakeJob will attempt to
+// either insert a new job or find the active job for a repo URL
+const maxEnqueueAttempts = 3
+
+// InsertBakeJob adds a new queued bake job for the provided repo URL and options.
+//
+// Only one queued or running job may exist for a given repo URL and options.
+// If there is already such an active job, that job is returned instead and
+// the returned bool is false.
+func (p PizzaOvenDbHandler) InsertBakeJob(ctx context.Context, repoURL string, opts jobs.Options) (*jobs.Job, bool, error) {
+	for i := 0; i < maxEnqueueAttempts; i++ {
+		row := p.db.QueryRowContext(ctx, `
+			INSERT INTO public.bake_jobs(id, clone_url, options, status) VALUES($1, $2, $3, $4)
+			ON CONFLICT (clone_url, options) WHERE status IN ('queued', 'running')
+			DO NOTHING
+			RETURNING `+bakeJobColumns,
+			uuid.New().String(), repoURL, opts, jobs.StatusQueued,
+		)
+
+		job, err := scanBakeJob(row)
+		if err == nil {
+			return job, true, nil
+		}
+
+		if err != sql.ErrNoRows {
+			return nil, false, err
+		}
+
+		// There is an active job for this repo URL, attach to it.
+		row = p.db.QueryRowContext(ctx,
+			"SELECT "+bakeJobColumns+" FROM public.bake_jobs WHERE clone_url=$1 AND options=$2 AND status IN ('queued', 'running')",
+			repoURL, opts,
+		)
+
+		job, err = scanBakeJob(row)
+		if err == nil {
+			return job, false, nil
+		}
+
+		// If the active job finished between the insert and the select, try
+		// again to insert a new job
+		if err != sql.ErrNoRows {
+			return nil, false, err
+		}
+	}
+
+	return nil, false, fmt.Errorf("could not enqueue bake job for %s after %d attempts", repoURL, maxEnqueueAttempts)
+}
+
+// GetBakeJob queries a bake job by its id. If there is no such job,
+// sql.ErrNoRows is returned.
+func (p PizzaOvenDbHandler) GetBakeJob(ctx context.Context, id string) (*jobs.Job, error) {
+	row := p.db.QueryRowContext(ctx, "SELECT "+bakeJobColumns+" FROM public.bake_jobs WHERE id=$1", id)
+	return scanBakeJob(row)
+}
+
+// ClaimBakeJob atomically claims the oldest queued bake job, marking it as
+// running. Running jobs whose heartbeat is older than staleAfter are assumed
+// to have been abandoned and may also be claimed, unless they have already
+// been attempted maxAttempts times. See FailAbandonedBakeJobs.
+//
+// Rows are locked using "FOR UPDATE SKIP LOCKED" so multiple workers (across
+// multiple pizza oven instances) may share a single queue without claiming
+// the same job. Each claim is given a new claim id which the claiming worker
+// records the job's heartbeat and result with. If there are no jobs to claim,
+// a nil job is returned.
+func (p PizzaOvenDbHandler) ClaimBakeJob(ctx context.Context, staleAfter time.Duration, maxAttempts int) (*jobs.Job, error) {
+	row := p.db.QueryRowContext(ctx, `
+		UPDATE public.bake_jobs
+		SET status=$1, attempts=attempts+1, started_at=now(), heartbeat_at=now(), phase=NULL, phase_count=0, claim_id=$5
+		WHERE id = (
+			SELECT id FROM public.bake_jobs
+			WHERE status=$2 OR (status=$1 AND heartbeat_at < now() - make_interval(secs => $3) AND attempts < $4)
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+bakeJobColumns,
+		jobs.StatusRunning, jobs.StatusQueued, staleAfter.Seconds(), maxAttempts, uuid.New().String(),
+	)
+
+	job, err := scanBakeJob(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return job, err
+}
+
+// FailAbandonedBakeJobs marks running jobs whose heartbeat is older than
+// staleAfter and that have already been attempted maxAttempts times as failed,
+// rather than letting them be claimed again. The failed jobs are returned.
+func (p PizzaOvenDbHandler) FailAbandonedBakeJobs(ctx context.Context, staleAfter time.Duration, maxAttempts int) ([]*jobs.Job, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		UPDATE public.bake_jobs
+		SET status=$1, error=$2, finished_at=now(), phase=$3
+		WHERE status=$4 AND heartbeat_at < now() - make_interval(secs => $5) AND attempts >= $6
+		RETURNING `+bakeJobColumns,
+		jobs.StatusFailed, fmt.Sprintf("bake job was abandoned after %d attempts", maxAttempts), jobs.PhaseDone,
+		jobs.StatusRunning, staleAfter.Seconds(), maxAttempts,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	failed := []*jobs.Job{}
+	for rows.Next() {
+		job, err := scanBakeJob(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		failed = append(failed, job)
+	}
+
+	return failed, rows.Err()
+}
+
+// HeartbeatBakeJob records that the given running job is still being processed
+// under the given claim. If the job is no longer running under that claim,
+// ErrBakeJobLost is returned.
+func (p PizzaOvenDbHandler) HeartbeatBakeJob(ctx context.Context, id string, claimID string) error {
+	res, err := p.db.ExecContext(ctx,
+		"UPDATE public.bake_jobs SET heartbeat_at=now() WHERE id=$1 AND claim_id=$2 AND status=$3",
+		id, claimID, jobs.StatusRunning,
+	)
+	if err != nil {
+		return err
+	}
+
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if updated == 0 {
+		return ErrBakeJobLost
+	}
+
+	return nil
+}
+
+// UpdateBakeJobProgress records the phase of processing the given running job
+// is at along with the number of commits walked in that phase so far
+func (p PizzaOvenDbHandler) UpdateBakeJobProgress(ctx context.Context, id string, phase jobs.Phase, count int64) error {
+	_, err := p.db.ExecContext(ctx, "UPDATE public.bake_jobs SET phase=$2, phase_count=$3 WHERE id=$1 AND status=$4", id, phase, count, jobs.StatusRunning)
+	return err
+}
+
+// RequeueBakeJobs returns the jobs running under the given claims to the queue
+// so they may be claimed again, by this or another pizza oven instance, from
+// the start. The jobs were stopped rather than abandoned, so the attempt is not
+// counted towards their maximum number of attempts. The number of jobs that
+// were requeued is returned.
+func (p PizzaOvenDbHandler) RequeueBakeJobs(ctx context.Context, claimIDs []string) (int64, error) {
+	res, err := p.db.ExecContext(ctx,
+		"UPDATE public.bake_jobs SET status=$2, attempts=greatest(attempts-1, 0), started_at=NULL, heartbeat_at=NULL, phase=NULL, phase_count=0, claim_id=NULL WHERE claim_id=ANY($1) AND status=$3",
+		pq.Array(claimIDs), jobs.StatusQueued, jobs.StatusRunning,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// FinishBakeJob marks the given job running under the given claim as succeeded
+// or, if the provided error is non-nil, as failed. The updated job is returned.
+// If the job is no longer running under that claim, it is left as is and
+// ErrBakeJobLost is returned.
+func (p PizzaOvenDbHandler) FinishBakeJob(ctx context.Context, id string, claimID string, commitsInserted int64, jobErr error) (*jobs.Job, error) {
+	status := jobs.StatusSucceeded
+	var errMsg sql.NullString
+	if jobErr != nil {
+		status = jobs.StatusFailed
+		errMsg = sql.NullString{String: jobErr.Error(), Valid: true}
+	}
+
+	row := p.db.QueryRowContext(ctx,
+		"UPDATE public.bake_jobs SET status=$3, commits_inserted=$4, error=$5, finished_at=now(), phase=$6 WHERE id=$1 AND claim_id=$2 AND status=$7 RETURNING "+bakeJobColumns,
+		id, claimID, status, commitsInserted, errMsg, jobs.PhaseDone, jobs.StatusRunning,
+	)
+
+	job, err := scanBakeJob(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrBakeJobLost
+	}
+
+	return job, err
+}
+
+// scanBakeJob scans a single bake job row selected with bakeJobColumns
+func scanBakeJob(row rowScanner) (*jobs.Job, error) {
+	var job jobs.Job
+	var startedAt, finishedAt sql.NullTime
+	var errMsg, phase, claimID sql.NullString
+
+	err := row.Scan(&job.ID, &job.RepoURL, &job.Options, &job.Status, &job.Attempts, &job.CreatedAt, &startedAt, &finishedAt, &job.CommitsInserted, &errMsg, &phase, &job.PhaseCount, &claimID)
+	if err != nil {
+		return nil, err
+	}
+
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+
+	job.Error = errMsg.String
+	job.Phase = jobs.Phase(phase.String)
+	job.ClaimID = claimID.String
+
+	return &job, nil
+}
+
+// ListTargetedBakeRefs queries the distinct refs and commits whose history
+// was baked by the succeeded targeted bakes of the given repo URL. See
+// jobs.Options.IsTargeted.
+func (p PizzaOvenDbHandler) ListTargetedBakeRefs(ctx context.Context, repoURL string) ([]string, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT DISTINCT coalesce(options->>'to', options->>'ref')
+		FROM public.bake_jobs
+		WHERE clone_url=$1 AND status=$2 AND (options ? 'to' OR options ? 'ref')
+	`, repoURL, jobs.StatusSucceeded)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	targets := []string{}
+	for rows.Next() {
+		var target string
+		err := rows.Scan(&target)
+		if err != nil {
+			return nil, err
+		}
+
+		targets = append(targets, target)
+	}
+
+	return targets, rows.Err()
+}
+
+// RepositoryBakeTime is when a baked repo was last baked or requested to be
+// baked. Repos that have never been baked have a nil last baked time.
+type RepositoryBakeTime struct {
+	URL         string
+	LastBakedAt *time.Time
+}
+
+// ListRepositoryBakeTimes queries every baked repo along with the latest of
+// the creation of its most recent bake job and its last indexed time
+func (p PizzaOvenDbHandler) ListRepositoryBakeTimes(ctx context.Context) ([]RepositoryBakeTime, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT r.clone_url, greatest(r.last_indexed_at, (
+			SELECT max(j.created_at) FROM public.bake_jobs j WHERE j.clone_url=r.clone_url
+		))
+		FROM public.baked_repos r
+		ORDER BY r.id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bakeTimes := []RepositoryBakeTime{}
+	for rows.Next() {
+		var bakeTime RepositoryBakeTime
+		var lastBakedAt sql.NullTime
+		err := rows.Scan(&bakeTime.URL, &lastBakedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		if lastBakedAt.Valid {
+			bakeTime.LastBakedAt = &lastBakedAt.Time
+		}
+
+		bakeTimes = append(bakeTimes, bakeTime)
+	}
+
+	return bakeTimes, rows.Err()
+}
+
+// AddBakeJobCallback registers a callback URL which is notified when the given
+// job finishes. Callbacks may only be added to queued or running jobs: if the
+// job has already finished, no callback is added and false is returned.
+func (p PizzaOvenDbHandler) AddBakeJobCallback(ctx context.Context, jobID string, callbackURL string) (bool, error) {
+	// The job is locked so it can not finish, and have its callbacks
+	// notified, before the callback has been added
+	result, err := p.db.ExecContext(ctx, `
+		INSERT INTO public.bake_job_callbacks(job_id, callback_url)
+		SELECT id, $2 FROM public.bake_jobs
+		WHERE id=$1 AND status IN ('queued', 'running')
+		FOR SHARE
+	`, jobID, callbackURL)
+	if err != nil {
+		return false, err
+	}
+
+	added, err := result.RowsAffected()
+	return added > 0, err
+}
+
+// GetBakeJobCallbacks queries the unique callback URLs of the given job
+func (p PizzaOvenDbHandler) GetBakeJobCallbacks(ctx context.Context, jobID string) ([]string, error) {
+	rows, err := p.db.QueryContext(ctx, "SELECT DISTINCT callback_url FROM public.bake_job_callbacks WHERE job_id=$1", jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	callbackURLs := []string{}
+	for rows.Next() {
+		var callbackURL string
+		err := rows.Scan(&callbackURL)
+		if err != nil {
+			return nil, err
+		}
+
+		callbackURLs = append(callbackURLs, callbackURL)
+	}
+
+	return callbackURLs, rows.Err()
+}
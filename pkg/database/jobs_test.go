@@ -0,0 +1,234 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/open-sauced/pizza/oven/pkg/internal/testutil"
+	"github.com/open-sauced/pizza/oven/pkg/jobs"
+)
+
+// testDbHandler is a convenience method for testing that returns a handler
+// for the test database. See testutil.Database.
+func testDbHandler(t *testing.T) *PizzaOvenDbHandler {
+	t.Helper()
+
+	db, _ := testutil.Database(t)
+	return &PizzaOvenDbHandler{db: db}
+}
+
+func TestInsertBakeJob(t *testing.T) {
+	p := testDbHandler(t)
+	ctx := context.Background()
+
+	job, created, err := p.InsertBakeJob(ctx, "https://github.com/open-sauced/pizza", jobs.Options{})
+	if err != nil {
+		t.Fatalf("unexpected err inserting job: %s", err.Error())
+	}
+
+	if !created || job.Status != jobs.StatusQueued {
+		t.Fatalf("job: %+v was not created as queued", job)
+	}
+
+	// Requests for the same repo and options are coalesced into the active job
+	coalesced, created, err := p.InsertBakeJob(ctx, "https://github.com/open-sauced/pizza", jobs.Options{})
+	if err != nil {
+		t.Fatalf("unexpected err inserting job: %s", err.Error())
+	}
+
+	if created || coalesced.ID != job.ID {
+		t.Fatalf("job: %s was not coalesced into active job: %s", coalesced.ID, job.ID)
+	}
+
+	// Requests with other options are not
+	stats, created, err := p.InsertBakeJob(ctx, "https://github.com/open-sauced/pizza", jobs.Options{Stats: true})
+	if err != nil {
+		t.Fatalf("unexpected err inserting job: %s", err.Error())
+	}
+
+	if !created || stats.ID == job.ID {
+		t.Fatalf("job with other options was coalesced into active job: %s", job.ID)
+	}
+}
+
+func TestClaimAndFinishBakeJob(t *testing.T) {
+	p := testDbHandler(t)
+	ctx := context.Background()
+
+	first, _, err := p.InsertBakeJob(ctx, "https://github.com/open-sauced/pizza", jobs.Options{})
+	if err != nil {
+		t.Fatalf("unexpected err inserting job: %s", err.Error())
+	}
+
+	second, _, err := p.InsertBakeJob(ctx, "https://github.com/open-sauced/insights", jobs.Options{})
+	if err != nil {
+		t.Fatalf("unexpected err inserting job: %s", err.Error())
+	}
+
+	// Jobs are claimed oldest first until the queue is empty
+	for _, expected := range []*jobs.Job{first, second, nil} {
+		claimed, err := p.ClaimBakeJob(ctx, time.Hour, 3)
+		if err != nil {
+			t.Fatalf("unexpected err claiming job: %s", err.Error())
+		}
+
+		if expected == nil {
+			if claimed != nil {
+				t.Fatalf("claimed job: %s from an empty queue", claimed.ID)
+			}
+
+			continue
+		}
+
+		if claimed == nil || claimed.ID != expected.ID {
+			t.Fatalf("claimed job: %v is not expected: %s", claimed, expected.ID)
+		}
+
+		if claimed.Status != jobs.StatusRunning || claimed.Attempts != 1 || claimed.ClaimID == "" {
+			t.Fatalf("claimed job: %+v is not running under a claim", claimed)
+		}
+
+		expected.ClaimID = claimed.ClaimID
+	}
+
+	if err := p.HeartbeatBakeJob(ctx, first.ID, first.ClaimID); err != nil {
+		t.Fatalf("unexpected err recording heartbeat: %s", err.Error())
+	}
+
+	// Only the worker that claimed the job may update it
+	otherClaim := uuid.New().String()
+	if err := p.HeartbeatBakeJob(ctx, first.ID, otherClaim); err != ErrBakeJobLost {
+		t.Fatalf("heartbeat under another claim err: %v is not expected: %v", err, ErrBakeJobLost)
+	}
+
+	if _, err := p.FinishBakeJob(ctx, first.ID, otherClaim, 0, nil); err != ErrBakeJobLost {
+		t.Fatalf("finishing under another claim err: %v is not expected: %v", err, ErrBakeJobLost)
+	}
+
+	finished, err := p.FinishBakeJob(ctx, first.ID, first.ClaimID, 42, nil)
+	if err != nil {
+		t.Fatalf("unexpected err finishing job: %s", err.Error())
+	}
+
+	if finished.Status != jobs.StatusSucceeded || finished.CommitsInserted != 42 {
+		t.Fatalf("finished job: %+v is not expected to have succeeded with 42 commits", finished)
+	}
+
+	failed, err := p.FinishBakeJob(ctx, second.ID, second.ClaimID, 0, fmt.Errorf("could not clone"))
+	if err != nil {
+		t.Fatalf("unexpected err finishing job: %s", err.Error())
+	}
+
+	if failed.Status != jobs.StatusFailed || failed.Error != "could not clone" {
+		t.Fatalf("finished job: %+v is not expected to have failed", failed)
+	}
+
+	// Finished jobs may not be finished again
+	if _, err := p.FinishBakeJob(ctx, first.ID, first.ClaimID, 0, nil); err != ErrBakeJobLost {
+		t.Fatalf("finishing a finished job err: %v is not expected: %v", err, ErrBakeJobLost)
+	}
+}
+
+func TestClaimStaleBakeJob(t *testing.T) {
+	p := testDbHandler(t)
+	ctx := context.Background()
+
+	job, _, err := p.InsertBakeJob(ctx, "https://github.com/open-sauced/pizza", jobs.Options{})
+	if err != nil {
+		t.Fatalf("unexpected err inserting job: %s", err.Error())
+	}
+
+	abandoned, err := p.ClaimBakeJob(ctx, time.Hour, 2)
+	if err != nil || abandoned == nil {
+		t.Fatalf("could not claim job: %v", err)
+	}
+
+	// Running jobs are not claimed while their heartbeat is fresh
+	claimed, err := p.ClaimBakeJob(ctx, time.Hour, 2)
+	if err != nil {
+		t.Fatalf("unexpected err claiming job: %s", err.Error())
+	}
+
+	if claimed != nil {
+		t.Fatalf("claimed running job: %s with a fresh heartbeat", claimed.ID)
+	}
+
+	// Once the heartbeat is stale, the job is reclaimed under a new claim and
+	// the worker that abandoned it may no longer update it
+	time.Sleep(10 * time.Millisecond)
+	reclaimed, err := p.ClaimBakeJob(ctx, time.Millisecond, 2)
+	if err != nil {
+		t.Fatalf("unexpected err claiming job: %s", err.Error())
+	}
+
+	if reclaimed == nil || reclaimed.ID != job.ID || reclaimed.Attempts != 2 || reclaimed.ClaimID == abandoned.ClaimID {
+		t.Fatalf("reclaimed job: %+v is not expected: %s on its second attempt", reclaimed, job.ID)
+	}
+
+	if err := p.HeartbeatBakeJob(ctx, job.ID, abandoned.ClaimID); err != ErrBakeJobLost {
+		t.Fatalf("heartbeat under abandoned claim err: %v is not expected: %v", err, ErrBakeJobLost)
+	}
+
+	if _, err := p.FinishBakeJob(ctx, job.ID, abandoned.ClaimID, 0, nil); err != ErrBakeJobLost {
+		t.Fatalf("finishing under abandoned claim err: %v is not expected: %v", err, ErrBakeJobLost)
+	}
+
+	// Once the job has been abandoned on its last attempt, it is failed rather
+	// than reclaimed
+	time.Sleep(10 * time.Millisecond)
+	claimed, err = p.ClaimBakeJob(ctx, time.Millisecond, 2)
+	if err != nil {
+		t.Fatalf("unexpected err claiming job: %s", err.Error())
+	}
+
+	if claimed != nil {
+		t.Fatalf("claimed job: %s after its last attempt", claimed.ID)
+	}
+
+	failed, err := p.FailAbandonedBakeJobs(ctx, time.Millisecond, 2)
+	if err != nil {
+		t.Fatalf("unexpected err failing abandoned jobs: %s", err.Error())
+	}
+
+	if len(failed) != 1 || failed[0].ID != job.ID || failed[0].Status != jobs.StatusFailed {
+		t.Fatalf("failed jobs: %v are not expected: [%s]", failed, job.ID)
+	}
+}
+
+func TestRequeueBakeJobs(t *testing.T) {
+	p := testDbHandler(t)
+	ctx := context.Background()
+
+	job, _, err := p.InsertBakeJob(ctx, "https://github.com/open-sauced/pizza", jobs.Options{})
+	if err != nil {
+		t.Fatalf("unexpected err inserting job: %s", err.Error())
+	}
+
+	claimed, err := p.ClaimBakeJob(ctx, time.Hour, 3)
+	if err != nil || claimed == nil {
+		t.Fatalf("could not claim job: %v", err)
+	}
+
+	requeued, err := p.RequeueBakeJobs(ctx, []string{claimed.ClaimID, uuid.New().String()})
+	if err != nil {
+		t.Fatalf("unexpected err requeueing jobs: %s", err.Error())
+	}
+
+	if requeued != 1 {
+		t.Fatalf("requeued jobs: %d is not expected: 1", requeued)
+	}
+
+	// Requeued jobs are not charged for the attempt they were stopped on
+	reclaimed, err := p.ClaimBakeJob(ctx, time.Hour, 3)
+	if err != nil {
+		t.Fatalf("unexpected err claiming job: %s", err.Error())
+	}
+
+	if reclaimed == nil || reclaimed.ID != job.ID || reclaimed.Attempts != 1 {
+		t.Fatalf("reclaimed job: %+v is not expected: %s on its first attempt", reclaimed, job.ID)
+	}
+}
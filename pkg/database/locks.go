@@ -0,0 +1,165 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+)
+
+// RepositoryLock is a session level postgres advisory lock held on a single
+// baked repository. Since advisory locks are shared across every connection
+// to the database, it ensures only one pizza oven instance at a time
+// processes a given repository.
+type RepositoryLock struct {
+	conn   *sql.Conn
+	repoID int
+}
+
+// AcquireRepositoryLock blocks until the advisory lock keyed on the given
+// baked_repos id is acquired or the context is done. The lock is held on a
+// dedicated connection from the pool until "Release()" is called.
+func (p PizzaOvenDbHandler) AcquireRepositoryLock(ctx context.Context, repoID int) (*RepositoryLock, error) {
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", repoID)
+	if err != nil {
+		newErr := conn.Close()
+		if newErr != nil {
+			return nil, fmt.Errorf("could not close the lock connection: %s - original error: %s", newErr, err)
+		}
+
+		return nil, err
+	}
+
+	return &RepositoryLock{
+		conn:   conn,
+		repoID: repoID,
+	}, nil
+}
+
+// TryAcquireRepositoryLock attempts to acquire the advisory lock keyed on the
+// given baked_repos id without blocking. If another session already holds the
+// lock, i.e. the repository is being baked, a nil lock is returned. The lock
+// is held on a dedicated connection from the pool until "Release()" is called.
+func (p PizzaOvenDbHandler) TryAcquireRepositoryLock(ctx context.Context, repoID int) (*RepositoryLock, error) {
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var acquired bool
+	err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", repoID).Scan(&acquired)
+	if err != nil {
+		newErr := conn.Close()
+		if newErr != nil {
+			return nil, fmt.Errorf("could not close the lock connection: %s - original error: %s", newErr, err)
+		}
+
+		return nil, err
+	}
+
+	if !acquired {
+		return nil, conn.Close()
+	}
+
+	return &RepositoryLock{
+		conn:   conn,
+		repoID: repoID,
+	}, nil
+}
+
+// Release unlocks the advisory lock and returns its connection to the pool.
+// It does not take a context since the lock must be released even when the
+// work it guarded was cancelled.
+func (l *RepositoryLock) Release() error {
+	_, err := l.conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", l.repoID)
+	if err != nil {
+		// The session may still hold the lock so, instead of returning the
+		// connection to the pool, discard it. Closing the underlying
+		// connection ends the session which releases any advisory locks it holds.
+		//nolint:errcheck
+		l.conn.Raw(func(any) error {
+			return driver.ErrBadConn
+		})
+	}
+
+	newErr := l.conn.Close()
+	if err != nil {
+		return err
+	}
+
+	return newErr
+}
+
+// The scheduler lock is keyed using the two int form of advisory locks, whose
+// key space does not overlap with the single bigint keys of repository locks
+const (
+	// schedulerLockClass namespaces the advisory locks of pizza ovens ("pizz")
+	schedulerLockClass = 0x70697a7a
+
+	// schedulerLockID identifies the scheduler lock within its namespace
+	schedulerLockID = 1
+)
+
+// SchedulerLock is a session level postgres advisory lock held by the single
+// pizza oven instance which schedules periodic bakes
+type SchedulerLock struct {
+	conn *sql.Conn
+}
+
+// TryAcquireSchedulerLock attempts to acquire the scheduler lock without
+// blocking. If another session already holds the lock, a nil lock is
+// returned. The lock is held on a dedicated connection from the pool until
+// "Release()" is called.
+func (p PizzaOvenDbHandler) TryAcquireSchedulerLock(ctx context.Context) (*SchedulerLock, error) {
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var acquired bool
+	err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1, $2)", schedulerLockClass, schedulerLockID).Scan(&acquired)
+	if err != nil {
+		newErr := conn.Close()
+		if newErr != nil {
+			return nil, fmt.Errorf("could not close the lock connection: %s - original error: %s", newErr, err)
+		}
+
+		return nil, err
+	}
+
+	if !acquired {
+		return nil, conn.Close()
+	}
+
+	return &SchedulerLock{conn: conn}, nil
+}
+
+// Held returns true if the session holding the lock is still alive. The lock
+// is lost along with its session if the connection to the database drops.
+func (l *SchedulerLock) Held(ctx context.Context) bool {
+	return l.conn.PingContext(ctx) == nil
+}
+
+// Release unlocks the advisory lock and returns its connection to the pool
+func (l *SchedulerLock) Release() error {
+	_, err := l.conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1, $2)", schedulerLockClass, schedulerLockID)
+	if err != nil {
+		// Discard the connection so its session, and any lock it holds, ends
+		//nolint:errcheck
+		l.conn.Raw(func(any) error {
+			return driver.ErrBadConn
+		})
+	}
+
+	newErr := l.conn.Close()
+	if err != nil {
+		return err
+	}
+
+	return newErr
+}
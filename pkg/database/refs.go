@@ -0,0 +1,151 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"github.com/open-sauced/pizza/oven/pkg/insights"
+)
+
+// GetRefs queries the branches and tags of the given repo as of its last bake
+func (p PizzaOvenDbHandler) GetRefs(ctx context.Context, repoID int) ([]insights.RefInsight, error) {
+	rows, err := p.db.QueryContext(ctx, "SELECT ref_name, ref_type, target_hash, tag_date FROM public.refs WHERE baked_repo_id=$1", repoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	refs := []insights.RefInsight{}
+	for rows.Next() {
+		var ref insights.RefInsight
+		var tagDate sql.NullTime
+		if err := rows.Scan(&ref.Name, &ref.Type, &ref.TargetHash, &tagDate); err != nil {
+			return nil, err
+		}
+
+		ref.TagDate = tagDate.Time
+		refs = append(refs, ref)
+	}
+
+	return refs, rows.Err()
+}
+
+// PrepareBulkRefInsert creates a temporary table within the given transaction
+// which mirrors the refs table and gets a bulk statement ready to copy the
+// current refs of a repo into it
+func (p PizzaOvenDbHandler) PrepareBulkRefInsert(ctx context.Context, txn *sql.Tx, tmpTableName string) (*sql.Stmt, error) {
+	_, err := txn.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TEMPORARY TABLE %s ON COMMIT DROP AS
+		SELECT ref_name, ref_type, target_hash, tag_date FROM refs WHERE 1=0
+	`, tmpTableName))
+	if err != nil {
+		return nil, err
+	}
+
+	return txn.PrepareContext(ctx, pq.CopyIn(tmpTableName, "ref_name", "ref_type", "target_hash", "tag_date"))
+}
+
+// InsertRef adds a ref to the given sql.Stmt to be executed in bulk
+func (p PizzaOvenDbHandler) InsertRef(ctx context.Context, stmt *sql.Stmt, ref insights.RefInsight) error {
+	tagDate := sql.NullTime{Time: ref.TagDate.UTC(), Valid: !ref.TagDate.IsZero()}
+	_, err := stmt.ExecContext(ctx, ref.Name, string(ref.Type), ref.TargetHash, tagDate)
+	return err
+}
+
+// PivotTmpTableToRefsTable executes the bulk ref statement and performs the
+// pivot from the temporary refs table to the real one. The given repo's refs
+// are replaced by the current refs: new refs are inserted, moved refs are
+// updated and refs that no longer exist are deleted along with their commits.
+func (p PizzaOvenDbHandler) PivotTmpTableToRefsTable(ctx context.Context, txn *sql.Tx, stmt *sql.Stmt, tmpTableName string, repoID int) error {
+	_, err := stmt.ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = stmt.Close()
+	if err != nil {
+		return err
+	}
+
+	_, err = txn.ExecContext(ctx, fmt.Sprintf(`
+		DELETE FROM public.refs r
+		WHERE r.baked_repo_id=$1 AND NOT EXISTS (
+			SELECT 1 FROM %s t WHERE t.ref_type=r.ref_type AND t.ref_name=r.ref_name
+		)
+	`, tmpTableName), repoID)
+	if err != nil {
+		return err
+	}
+
+	_, err = txn.ExecContext(ctx, fmt.Sprintf(`
+		INSERT INTO public.refs(baked_repo_id, ref_name, ref_type, target_hash, tag_date)
+		SELECT $1, ref_name, ref_type, target_hash, tag_date FROM %s
+		ON CONFLICT (baked_repo_id, ref_type, ref_name)
+		DO UPDATE SET target_hash=EXCLUDED.target_hash, tag_date=EXCLUDED.tag_date, updated_at=now()
+		WHERE refs.target_hash IS DISTINCT FROM EXCLUDED.target_hash OR refs.tag_date IS DISTINCT FROM EXCLUDED.tag_date
+	`, tmpTableName), repoID)
+
+	return err
+}
+
+// DeleteRefCommits removes all the commits recorded for the given ref of a
+// repo, i.e. when the history of the ref has been rewritten
+func (p PizzaOvenDbHandler) DeleteRefCommits(ctx context.Context, txn *sql.Tx, repoID int, ref insights.RefInsight) error {
+	_, err := txn.ExecContext(ctx, `
+		DELETE FROM public.commit_refs cr
+		USING public.refs r
+		WHERE cr.ref_id=r.id AND r.baked_repo_id=$1 AND r.ref_type=$2 AND r.ref_name=$3
+	`, repoID, string(ref.Type), ref.Name)
+	return err
+}
+
+// PrepareBulkRefCommitInsert creates a temporary table within the given
+// transaction which holds refs and the hashes of the commits reachable from
+// them and gets a bulk statement ready to copy them into it
+func (p PizzaOvenDbHandler) PrepareBulkRefCommitInsert(ctx context.Context, txn *sql.Tx, tmpTableName string) (*sql.Stmt, error) {
+	_, err := txn.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TEMPORARY TABLE %s ON COMMIT DROP AS
+		SELECT r.ref_name, r.ref_type, c.commit_hash FROM refs r, commits c WHERE 1=0
+	`, tmpTableName))
+	if err != nil {
+		return nil, err
+	}
+
+	return txn.PrepareContext(ctx, pq.CopyIn(tmpTableName, "ref_name", "ref_type", "commit_hash"))
+}
+
+// InsertRefCommit adds a commit reachable from the given ref to the given
+// sql.Stmt to be executed in bulk
+func (p PizzaOvenDbHandler) InsertRefCommit(ctx context.Context, stmt *sql.Stmt, ref insights.RefInsight, hash string) error {
+	_, err := stmt.ExecContext(ctx, ref.Name, string(ref.Type), hash)
+	return err
+}
+
+// PivotTmpTableToRefCommitsTable executes the bulk ref commit statement and
+// performs the pivot from the temporary ref commits table to the real one by
+// resolving the ids of the given repoID's refs and commits
+func (p PizzaOvenDbHandler) PivotTmpTableToRefCommitsTable(ctx context.Context, txn *sql.Tx, stmt *sql.Stmt, tmpTableName string, repoID int) error {
+	_, err := stmt.ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = stmt.Close()
+	if err != nil {
+		return err
+	}
+
+	_, err = txn.ExecContext(ctx, fmt.Sprintf(`
+		INSERT INTO public.commit_refs(commit_id, ref_id)
+		SELECT c.id, r.id FROM %s t
+		JOIN public.refs r ON r.baked_repo_id=$1 AND r.ref_type=t.ref_type AND r.ref_name=t.ref_name
+		JOIN public.commits c ON c.baked_repo_id=$1 AND c.commit_hash=t.commit_hash
+		ON CONFLICT (commit_id, ref_id)
+		DO NOTHING
+	`, tmpTableName), repoID)
+
+	return err
+}
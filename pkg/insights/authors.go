@@ -0,0 +1,24 @@
+package insights
+
+import "time"
+
+// AuthorInsight represents a single identity (a name and email pair) that has
+// authored, committed or co-authored commits and the range of time in which
+// that identity was seen.
+type AuthorInsight struct {
+	Email     string
+	Name      string
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+// Seen widens the range of time the identity was seen to include the given time
+func (a *AuthorInsight) Seen(when time.Time) {
+	if a.FirstSeen.IsZero() || when.Before(a.FirstSeen) {
+		a.FirstSeen = when
+	}
+
+	if when.After(a.LastSeen) {
+		a.LastSeen = when
+	}
+}
@@ -2,13 +2,94 @@
 // service. For now, only git commit insights are supported.
 package insights
 
-import "time"
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+)
 
 // CommitInsight is the main internal data structure that represents a single
 // git commit.
+//
+// The author of a commit is the person who originally wrote the patch while
+// the committer is the person who last applied it. Date is the commit date
+// of the committer.
+//
+// Author and committer identities are canonical identities resolved through a
+// mailmap. The raw emails found on the commit are kept for auditing.
 type CommitInsight struct {
-	RepoURLSource string
-	Hash          string
-	AuthorEmail   string
-	Date          time.Time
+	RepoURLSource     string
+	Hash              string
+	AuthorEmail       string
+	AuthorName        string
+	RawAuthorEmail    string
+	CommitterEmail    string
+	CommitterName     string
+	RawCommitterEmail string
+	Date              time.Time
+	AuthorDate        time.Time
+	Subject           string
+	Message           string
+	ParentHashes      []string
+	IsMerge           bool
+}
+
+// MessageSubject returns the subject of a commit message. Like git, the
+// subject is the first paragraph of the message joined into a single line.
+func MessageSubject(message string) string {
+	lines := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(message), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, " ")
+}
+
+// TruncateMessage truncates a commit message to at most maxBytes bytes
+// without splitting any multi-byte characters. A maxBytes of zero or less
+// does not truncate the message.
+func TruncateMessage(message string, maxBytes int) string {
+	if maxBytes <= 0 || len(message) <= maxBytes {
+		return message
+	}
+
+	// Back off until the cut is at the start of a character
+	cut := maxBytes
+	for cut > 0 && !utf8.RuneStart(message[cut]) {
+		cut--
+	}
+
+	return message[:cut]
+}
+
+// FileChangeType is the kind of change made to a file in a commit
+type FileChangeType string
+
+const (
+	// FileAdded denotes a file that was created by a commit
+	FileAdded FileChangeType = "added"
+
+	// FileModified denotes a file that was modified by a commit
+	FileModified FileChangeType = "modified"
+
+	// FileDeleted denotes a file that was deleted by a commit
+	FileDeleted FileChangeType = "deleted"
+
+	// FileRenamed denotes a file that was renamed, and possibly modified, by a commit
+	FileRenamed FileChangeType = "renamed"
+)
+
+// FileChange represents the changes made to a single file in a commit. The
+// previous path is only set for renamed files.
+type FileChange struct {
+	Path         string
+	PreviousPath string
+	Additions    int
+	Deletions    int
+	ChangeType   FileChangeType
 }
@@ -0,0 +1,88 @@
+package insights
+
+import "testing"
+
+func TestMessageSubject(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		message  string
+		expected string
+	}{
+		{
+			name:     "Single line message",
+			message:  "Fix the oven temperature\n",
+			expected: "Fix the oven temperature",
+		},
+		{
+			name:     "Message with body",
+			message:  "Fix the oven temperature\n\nIt was too hot.\n",
+			expected: "Fix the oven temperature",
+		},
+		{
+			name:     "Multi-line first paragraph is joined",
+			message:  "Fix the oven\ntemperature\n\nIt was too hot.",
+			expected: "Fix the oven temperature",
+		},
+		{
+			name:     "Leading blank lines are ignored",
+			message:  "\n\nFix the oven temperature",
+			expected: "Fix the oven temperature",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subject := MessageSubject(tt.message)
+			if subject != tt.expected {
+				t.Fatalf("subject: %q is not expected: %q", subject, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTruncateMessage(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		message  string
+		maxBytes int
+		expected string
+	}{
+		{
+			name:     "Does not truncate when unlimited",
+			message:  "Fix the oven temperature",
+			maxBytes: 0,
+			expected: "Fix the oven temperature",
+		},
+		{
+			name:     "Does not truncate short messages",
+			message:  "Fix the oven",
+			maxBytes: 100,
+			expected: "Fix the oven",
+		},
+		{
+			name:     "Truncates long messages",
+			message:  "Fix the oven temperature",
+			maxBytes: 12,
+			expected: "Fix the oven",
+		},
+		{
+			name:     "Does not split multi-byte characters",
+			message:  "Add 🍕 toppings",
+			maxBytes: 6,
+			expected: "Add ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			truncated := TruncateMessage(tt.message, tt.maxBytes)
+			if truncated != tt.expected {
+				t.Fatalf("truncated message: %q is not expected: %q", truncated, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package insights
+
+import "time"
+
+// RefType is the kind of a git ref
+type RefType string
+
+const (
+	// RefBranch denotes a branch of the remote repository
+	RefBranch RefType = "branch"
+
+	// RefTag denotes a tag of the remote repository
+	RefTag RefType = "tag"
+)
+
+// RefInsight represents a branch or tag of a git repository. The target hash
+// is the commit the ref points to and the tag date is only set for tags.
+type RefInsight struct {
+	Name       string
+	Type       RefType
+	TargetHash string
+	TagDate    time.Time
+}
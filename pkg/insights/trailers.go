@@ -0,0 +1,43 @@
+package insights
+
+import (
+	"regexp"
+	"strings"
+)
+
+// coAuthorTrailer matches a single "Co-authored-by: Name <email>" commit
+// message trailer. Trailer keys are matched case insensitively.
+var coAuthorTrailer = regexp.MustCompile(`(?i)^co-authored-by:\s*(.*?)\s*<([^<>\s]+)>\s*$`)
+
+// CoAuthor is a person credited on a commit through a "Co-authored-by" trailer
+type CoAuthor struct {
+	Name  string
+	Email string
+}
+
+// ParseCoAuthors returns the unique co-authors credited in the
+// "Co-authored-by" trailers of the provided commit message
+func ParseCoAuthors(message string) []CoAuthor {
+	coAuthors := []CoAuthor{}
+	seen := make(map[string]struct{})
+
+	for _, line := range strings.Split(message, "\n") {
+		matches := coAuthorTrailer.FindStringSubmatch(strings.TrimSpace(line))
+		if matches == nil {
+			continue
+		}
+
+		email := matches[2]
+		if _, ok := seen[email]; ok {
+			continue
+		}
+
+		seen[email] = struct{}{}
+		coAuthors = append(coAuthors, CoAuthor{
+			Name:  matches[1],
+			Email: email,
+		})
+	}
+
+	return coAuthors
+}
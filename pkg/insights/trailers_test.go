@@ -0,0 +1,58 @@
+package insights
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCoAuthors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		message  string
+		expected []CoAuthor
+	}{
+		{
+			name:     "No trailers",
+			message:  "Fix the oven temperature\n\nIt was too hot.",
+			expected: []CoAuthor{},
+		},
+		{
+			name:    "Single trailer",
+			message: "Fix the oven temperature\n\nCo-authored-by: Jane Doe <jane@example.com>",
+			expected: []CoAuthor{
+				{Name: "Jane Doe", Email: "jane@example.com"},
+			},
+		},
+		{
+			name:    "Multiple trailers with mixed case keys",
+			message: "Add toppings\n\nco-authored-by: Jane Doe <jane@example.com>\nCO-AUTHORED-BY: John Doe <john@example.com>\n",
+			expected: []CoAuthor{
+				{Name: "Jane Doe", Email: "jane@example.com"},
+				{Name: "John Doe", Email: "john@example.com"},
+			},
+		},
+		{
+			name:    "Duplicate trailers are ignored",
+			message: "Add toppings\n\nCo-authored-by: Jane Doe <jane@example.com>\nCo-authored-by: Jane <jane@example.com>",
+			expected: []CoAuthor{
+				{Name: "Jane Doe", Email: "jane@example.com"},
+			},
+		},
+		{
+			name:     "Malformed trailers are ignored",
+			message:  "Add toppings\n\nCo-authored-by: Jane Doe jane@example.com\nCo-authored-by Jane Doe <jane@example.com>",
+			expected: []CoAuthor{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			coAuthors := ParseCoAuthors(tt.message)
+			if !reflect.DeepEqual(coAuthors, tt.expected) {
+				t.Fatalf("co-authors: %v are not expected: %v", coAuthors, tt.expected)
+			}
+		})
+	}
+}
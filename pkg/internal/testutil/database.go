@@ -0,0 +1,73 @@
+// package testutil provides the fixtures shared by the tests of the pizza
+// oven packages
+package testutil
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	// the injected postgres interface implementations for Go SQL
+	_ "github.com/lib/pq"
+)
+
+// DatabaseConfig is the connection configuration of the test database
+type DatabaseConfig struct {
+	Host     string
+	Port     string
+	User     string
+	Password string
+	DBName   string
+}
+
+// Database is a convenience method for testing that connects to the postgres
+// database configured by the "TEST_DATABASE_*" env vars, applies the local
+// development schema and empties the bake queue. The connection is closed once
+// the test has finished. Tests using it are skipped unless
+// "TEST_DATABASE_HOST" is set.
+func Database(t *testing.T) (*sql.DB, DatabaseConfig) {
+	t.Helper()
+
+	config := DatabaseConfig{
+		Host:     os.Getenv("TEST_DATABASE_HOST"),
+		Port:     os.Getenv("TEST_DATABASE_PORT"),
+		User:     os.Getenv("TEST_DATABASE_USER"),
+		Password: os.Getenv("TEST_DATABASE_PASSWORD"),
+		DBName:   os.Getenv("TEST_DATABASE_DBNAME"),
+	}
+
+	if config.Host == "" {
+		t.Skip("TEST_DATABASE_HOST is not set, skipping database test")
+	}
+
+	db, err := sql.Open("postgres", fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+		config.Host, config.Port, config.User, config.Password, config.DBName))
+	if err != nil {
+		t.Fatalf("unexpected err opening test database: %s", err.Error())
+	}
+	t.Cleanup(func() {
+		//nolint:errcheck
+		db.Close()
+	})
+
+	// The schema is found relative to this file so that it may be applied
+	// by the tests of any package
+	_, file, _, _ := runtime.Caller(0)
+	schema, err := os.ReadFile(filepath.Join(filepath.Dir(file), "..", "..", "..", "hack", "pizza.sql"))
+	if err != nil {
+		t.Fatalf("unexpected err reading schema: %s", err.Error())
+	}
+
+	if _, err := db.Exec(string(schema)); err != nil {
+		t.Fatalf("unexpected err applying schema: %s", err.Error())
+	}
+
+	if _, err := db.Exec("DELETE FROM public.bake_jobs"); err != nil {
+		t.Fatalf("unexpected err emptying bake queue: %s", err.Error())
+	}
+
+	return db, config
+}
@@ -0,0 +1,178 @@
+// package jobs provides the data structures used to track the lifecycle of
+// individual bake requests made to the pizza oven service.
+package jobs
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// Status is the state of a bake job at a given point in time
+type Status string
+
+const (
+	// StatusQueued denotes a job that has been accepted but not yet claimed
+	// by a worker
+	StatusQueued Status = "queued"
+
+	// StatusRunning denotes a job that is currently being processed
+	StatusRunning Status = "running"
+
+	// StatusSucceeded denotes a job that has finished processing without error
+	StatusSucceeded Status = "succeeded"
+
+	// StatusFailed denotes a job that has finished processing with an error
+	StatusFailed Status = "failed"
+)
+
+// IsFinished returns true if the status is a terminal state
+func (s Status) IsFinished() bool {
+	return s == StatusSucceeded || s == StatusFailed
+}
+
+// Phase is the step of processing a running bake job is at
+type Phase string
+
+const (
+	// PhaseValidating denotes a job that is looking up its repo and waiting
+	// for any other bake of the repo to finish
+	PhaseValidating Phase = "validating"
+
+	// PhaseFetching denotes a job that is cloning or fetching its repo and
+	// planning which commits to walk
+	PhaseFetching Phase = "fetching"
+
+	// PhaseWalkingAuthors denotes a job that is walking the commits of its
+	// repo to collect their authors
+	PhaseWalkingAuthors Phase = "walking_authors"
+
+	// PhasePivotingAuthors denotes a job that is inserting the collected
+	// authors
+	PhasePivotingAuthors Phase = "pivoting_authors"
+
+	// PhaseInsertingCommits denotes a job that is walking and inserting the
+	// commits of its repo
+	PhaseInsertingCommits Phase = "inserting_commits"
+
+	// PhaseDone denotes a job that has finished processing
+	PhaseDone Phase = "done"
+)
+
+// Options are the optional settings a bake job was requested with. Jobs are
+// only coalesced with other active jobs for the same repo and options.
+type Options struct {
+	// Stats enables collecting the line and file change statistics of each
+	// commit which is considerably more expensive than indexing commits alone
+	Stats bool `json:"stats,omitempty"`
+
+	// AllRefs enables indexing the commits of every remote branch and tag,
+	// and recording the refs each commit is reachable from, instead of only
+	// the commits reachable from HEAD
+	AllRefs bool `json:"all_refs,omitempty"`
+
+	// Ref is a branch, tag or commit hash whose history is baked instead of
+	// the history of HEAD
+	Ref string `json:"ref,omitempty"`
+
+	// From and To are commit hashes bounding the range of commits that are
+	// baked, like "git log from..to". Commits reachable from From are
+	// excluded and To defaults to Ref, or HEAD.
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+
+	// Since and Until bound the window of commit dates that are baked
+	Since *time.Time `json:"since,omitempty"`
+	Until *time.Time `json:"until,omitempty"`
+
+	// Force deletes the existing commits of the repo and indexes it from
+	// scratch
+	Force bool `json:"force,omitempty"`
+}
+
+// IsTargeted returns true if the options target a specific ref, commit range
+// or date window. Targeted bakes do not update the incremental state of a repo,
+// i.e. its last indexed HEAD, so they can be used to backfill its history.
+func (o Options) IsTargeted() bool {
+	return o.Ref != "" || o.From != "" || o.To != "" || o.Since != nil || o.Until != nil
+}
+
+// Validate returns an error if the options can not be combined
+func (o Options) Validate() error {
+	if o.From != "" && !plumbing.IsHash(o.From) {
+		return fmt.Errorf("from must be a full commit hash: %s", o.From)
+	}
+
+	if o.To != "" && !plumbing.IsHash(o.To) {
+		return fmt.Errorf("to must be a full commit hash: %s", o.To)
+	}
+
+	if o.Ref != "" && o.To != "" {
+		return fmt.Errorf("ref and to can not be combined")
+	}
+
+	if o.Since != nil && o.Until != nil && o.Since.After(*o.Until) {
+		return fmt.Errorf("since must not be after until")
+	}
+
+	if o.AllRefs && o.IsTargeted() {
+		return fmt.Errorf("all_refs can not be combined with ref, from, to, since or until")
+	}
+
+	if o.Force && o.IsTargeted() {
+		return fmt.Errorf("force can not be combined with ref, from, to, since or until")
+	}
+
+	return nil
+}
+
+// Value implements the driver.Valuer interface, storing the options as json
+func (o Options) Value() (driver.Value, error) {
+	b, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(b), nil
+}
+
+// Scan implements the sql.Scanner interface, reading the options from json
+func (o *Options) Scan(src any) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, o)
+	case string:
+		return json.Unmarshal([]byte(v), o)
+	case nil:
+		*o = Options{}
+		return nil
+	default:
+		return fmt.Errorf("could not scan bake job options from type %T", src)
+	}
+}
+
+// Job represents a single request to bake a git repository
+type Job struct {
+	ID              string     `json:"id"`
+	RepoURL         string     `json:"url"`
+	Options         Options    `json:"options"`
+	Status          Status     `json:"status"`
+	Attempts        int        `json:"attempts"`
+	CreatedAt       time.Time  `json:"created_at"`
+	StartedAt       *time.Time `json:"started_at,omitempty"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`
+	CommitsInserted int64      `json:"commits_inserted"`
+	Error           string     `json:"error,omitempty"`
+
+	// Phase is the step of processing the job is at and PhaseCount is the
+	// number of commits walked in that step so far
+	Phase      Phase `json:"phase,omitempty"`
+	PhaseCount int64 `json:"phase_count,omitempty"`
+
+	// ClaimID identifies the attempt of the worker that last claimed the job.
+	// Only that worker may record the job's heartbeat and result.
+	ClaimID string `json:"-"`
+}
@@ -0,0 +1,126 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOptionsValueAndScan(t *testing.T) {
+	t.Parallel()
+
+	since := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	until := since.AddDate(1, 0, 0)
+
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{
+			name: "Default options",
+			opts: Options{},
+		},
+		{
+			name: "Stats enabled",
+			opts: Options{Stats: true},
+		},
+		{
+			name: "Targeted commit range and window",
+			opts: Options{
+				Ref:   "release",
+				From:  "0123456789012345678901234567890123456789",
+				Since: &since,
+				Until: &until,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := tt.opts.Value()
+			if err != nil {
+				t.Fatalf("unexpected err getting options value: %s", err.Error())
+			}
+
+			var scanned Options
+			err = scanned.Scan([]byte(value.(string)))
+			if err != nil {
+				t.Fatalf("unexpected err scanning options: %s", err.Error())
+			}
+
+			rescanned, err := scanned.Value()
+			if err != nil {
+				t.Fatalf("unexpected err getting scanned options value: %s", err.Error())
+			}
+
+			if rescanned != value {
+				t.Fatalf("scanned options: %v are not expected: %v", rescanned, value)
+			}
+		})
+	}
+}
+
+func TestOptionsScanError(t *testing.T) {
+	t.Parallel()
+
+	var opts Options
+	if err := opts.Scan(42); err == nil {
+		t.Fatalf("expected error scanning unsupported type, got none")
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	t.Parallel()
+
+	hash := "0123456789012345678901234567890123456789"
+	since := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	until := since.AddDate(1, 0, 0)
+
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr bool
+	}{
+		{
+			name: "Default options are valid",
+			opts: Options{},
+		},
+		{
+			name: "Commit range and window are valid",
+			opts: Options{From: hash, To: hash, Since: &since, Until: &until},
+		},
+		{
+			name:    "From must be a commit hash",
+			opts:    Options{From: "main"},
+			wantErr: true,
+		},
+		{
+			name:    "Ref and to can not be combined",
+			opts:    Options{Ref: "main", To: hash},
+			wantErr: true,
+		},
+		{
+			name:    "Since must not be after until",
+			opts:    Options{Since: &until, Until: &since},
+			wantErr: true,
+		},
+		{
+			name:    "All refs can not be targeted",
+			opts:    Options{AllRefs: true, Ref: "main"},
+			wantErr: true,
+		},
+		{
+			name:    "Force can not be targeted",
+			opts:    Options{Force: true, Since: &since},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected err: %v, expected error: %t", err, tt.wantErr)
+			}
+		})
+	}
+}
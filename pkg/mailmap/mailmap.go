@@ -0,0 +1,216 @@
+// package mailmap parses git ".mailmap" files and resolves the canonical
+// identities of commit authors. See "git help gitmailmap" for details on the
+// file format.
+package mailmap
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// identity is a canonical name and email. Empty fields are not replaced when
+// resolving an identity.
+type identity struct {
+	name  string
+	email string
+}
+
+// entry holds the canonical identity for a single commit email along with
+// any canonical identities that only apply to specific commit names
+type entry struct {
+	identity
+	byName map[string]identity
+}
+
+// Mailmap maps the names and emails found on commits to canonical identities.
+// Emails and names are matched case insensitively. A nil Mailmap is valid and
+// resolves every identity to itself.
+type Mailmap struct {
+	entries map[string]*entry
+}
+
+// New returns a new, empty Mailmap
+func New() *Mailmap {
+	return &Mailmap{
+		entries: make(map[string]*entry),
+	}
+}
+
+// Parse reads a mailmap file from the provided reader. Each line is one of:
+//
+//	Proper Name <commit@email.xx>
+//	<proper@email.xx> <commit@email.xx>
+//	Proper Name <proper@email.xx> <commit@email.xx>
+//	Proper Name <proper@email.xx> Commit Name <commit@email.xx>
+//
+// Comments start with "#" and continue to the end of the line.
+func Parse(r io.Reader) (*Mailmap, error) {
+	m := New()
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		err := m.parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse mailmap line %d: %s", lineNum, err.Error())
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// parseLine adds a single, non-empty mailmap line to the Mailmap
+func (m *Mailmap) parseLine(line string) error {
+	properName, properEmail, rest, err := nextNameAndEmail(line)
+	if err != nil {
+		return err
+	}
+
+	// "Proper Name <commit@email.xx>"
+	if strings.TrimSpace(rest) == "" {
+		m.add(identity{name: properName}, "", properEmail)
+		return nil
+	}
+
+	commitName, commitEmail, rest, err := nextNameAndEmail(rest)
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(rest) != "" {
+		return fmt.Errorf("unexpected trailing content: %s", rest)
+	}
+
+	m.add(identity{name: properName, email: properEmail}, commitName, commitEmail)
+	return nil
+}
+
+// add maps the commit name and email to the canonical identity. If the commit
+// name is empty, the canonical identity applies to every name using the email.
+func (m *Mailmap) add(canonical identity, commitName, commitEmail string) {
+	key := strings.ToLower(commitEmail)
+	e, ok := m.entries[key]
+	if !ok {
+		e = &entry{byName: make(map[string]identity)}
+		m.entries[key] = e
+	}
+
+	if commitName == "" {
+		if canonical.name != "" {
+			e.name = canonical.name
+		}
+
+		if canonical.email != "" {
+			e.email = canonical.email
+		}
+
+		return
+	}
+
+	e.byName[strings.ToLower(commitName)] = canonical
+}
+
+// Merge adds all the entries of the other Mailmap to this one. Entries from
+// the other Mailmap take precedence.
+func (m *Mailmap) Merge(other *Mailmap) {
+	if other == nil {
+		return
+	}
+
+	for email, e := range other.entries {
+		m.add(e.identity, "", email)
+		for name, canonical := range e.byName {
+			m.add(canonical, name, email)
+		}
+	}
+}
+
+// Resolve returns the canonical name and email for the provided commit name
+// and email
+func (m *Mailmap) Resolve(name, email string) (string, string) {
+	if m == nil {
+		return name, email
+	}
+
+	e, ok := m.entries[strings.ToLower(email)]
+	if !ok {
+		return name, email
+	}
+
+	canonical, ok := e.byName[strings.ToLower(name)]
+	if !ok {
+		canonical = e.identity
+	}
+
+	if canonical.name != "" {
+		name = canonical.name
+	}
+
+	if canonical.email != "" {
+		email = canonical.email
+	}
+
+	return name, email
+}
+
+// nextNameAndEmail parses an optional name followed by an email enclosed in
+// angle brackets from the start of s and returns the remainder of s
+func nextNameAndEmail(s string) (string, string, string, error) {
+	start := strings.Index(s, "<")
+	if start < 0 {
+		return "", "", "", fmt.Errorf("missing email in: %s", s)
+	}
+
+	end := strings.Index(s[start:], ">")
+	if end < 0 {
+		return "", "", "", fmt.Errorf("unterminated email in: %s", s)
+	}
+	end += start
+
+	name := strings.TrimSpace(s[:start])
+	email := strings.TrimSpace(s[start+1 : end])
+
+	return name, email, s[end+1:], nil
+}
+
+// FromCommit parses the ".mailmap" file at the root of the given commit's
+// tree. If there is no ".mailmap" file, an empty Mailmap is returned.
+func FromCommit(c *object.Commit) (*Mailmap, error) {
+	f, err := c.File(".mailmap")
+	if err != nil {
+		if err == object.ErrFileNotFound {
+			return New(), nil
+		}
+
+		return nil, err
+	}
+
+	r, err := f.Reader()
+	if err != nil {
+		return nil, err
+	}
+	//nolint:errcheck
+	defer r.Close()
+
+	return Parse(r)
+}
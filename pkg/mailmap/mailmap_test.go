@@ -0,0 +1,153 @@
+package mailmap
+
+import (
+	"strings"
+	"testing"
+)
+
+const testMailmap = `
+# Canonical names
+Jane Doe <jane@example.com>
+
+# Canonical emails
+<john@example.com> <john@old.example.com>
+
+Jane Doe <jane@example.com> <jane.doe@typo.example.com>  # trailing comment
+Pizza Bot <bot@example.com> builder <ci@example.com>
+`
+
+func TestResolve(t *testing.T) {
+	t.Parallel()
+
+	m, err := Parse(strings.NewReader(testMailmap))
+	if err != nil {
+		t.Fatalf("unexpected err parsing mailmap: %s", err.Error())
+	}
+
+	tests := []struct {
+		name          string
+		commitName    string
+		commitEmail   string
+		expectedName  string
+		expectedEmail string
+	}{
+		{
+			name:          "Replaces name",
+			commitName:    "jdoe",
+			commitEmail:   "jane@example.com",
+			expectedName:  "Jane Doe",
+			expectedEmail: "jane@example.com",
+		},
+		{
+			name:          "Replaces email",
+			commitName:    "John Doe",
+			commitEmail:   "john@old.example.com",
+			expectedName:  "John Doe",
+			expectedEmail: "john@example.com",
+		},
+		{
+			name:          "Replaces name and email matching email case insensitively",
+			commitName:    "jane",
+			commitEmail:   "Jane.Doe@Typo.Example.com",
+			expectedName:  "Jane Doe",
+			expectedEmail: "jane@example.com",
+		},
+		{
+			name:          "Replaces name and email matching name and email",
+			commitName:    "Builder",
+			commitEmail:   "ci@example.com",
+			expectedName:  "Pizza Bot",
+			expectedEmail: "bot@example.com",
+		},
+		{
+			name:          "Does not replace when name does not match",
+			commitName:    "deployer",
+			commitEmail:   "ci@example.com",
+			expectedName:  "deployer",
+			expectedEmail: "ci@example.com",
+		},
+		{
+			name:          "Does not replace unknown identities",
+			commitName:    "Someone",
+			commitEmail:   "someone@example.com",
+			expectedName:  "Someone",
+			expectedEmail: "someone@example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, email := m.Resolve(tt.commitName, tt.commitEmail)
+			if name != tt.expectedName || email != tt.expectedEmail {
+				t.Fatalf("resolved: %s <%s> is not expected: %s <%s>", name, email, tt.expectedName, tt.expectedEmail)
+			}
+		})
+	}
+}
+
+func TestResolveNilMailmap(t *testing.T) {
+	t.Parallel()
+
+	var m *Mailmap
+	name, email := m.Resolve("Jane Doe", "jane@example.com")
+	if name != "Jane Doe" || email != "jane@example.com" {
+		t.Fatalf("nil mailmap unexpectedly resolved identity to: %s <%s>", name, email)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	t.Parallel()
+
+	repoMailmap, err := Parse(strings.NewReader("Jane <jane@example.com>\n<john@example.com> <john@old.example.com>"))
+	if err != nil {
+		t.Fatalf("unexpected err parsing mailmap: %s", err.Error())
+	}
+
+	serverMailmap, err := Parse(strings.NewReader("Jane Doe <jane@example.com>"))
+	if err != nil {
+		t.Fatalf("unexpected err parsing mailmap: %s", err.Error())
+	}
+
+	m := New()
+	m.Merge(repoMailmap)
+	m.Merge(serverMailmap)
+
+	if name, _ := m.Resolve("jd", "jane@example.com"); name != "Jane Doe" {
+		t.Fatalf("merged mailmap did not prefer later entries, got name: %s", name)
+	}
+
+	if _, email := m.Resolve("John", "john@old.example.com"); email != "john@example.com" {
+		t.Fatalf("merged mailmap did not keep earlier entries, got email: %s", email)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		mailmap string
+	}{
+		{
+			name:    "Missing email fails",
+			mailmap: "Jane Doe",
+		},
+		{
+			name:    "Unterminated email fails",
+			mailmap: "Jane Doe <jane@example.com",
+		},
+		{
+			name:    "Trailing content fails",
+			mailmap: "Jane Doe <jane@example.com> <jane@old.example.com> extra",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.mailmap))
+			if err == nil {
+				t.Fatalf("expected error, got none")
+			}
+		})
+	}
+}
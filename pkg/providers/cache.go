@@ -1,6 +1,7 @@
 package providers
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/go-git/go-git/v5"
@@ -40,8 +41,9 @@ func NewLRUCacheGitRepoProvider(cacheDir string, minFreeDisk uint64, l *zap.Suga
 // FetchRepo returns a CachedGitRepo which statisfies the GitRepo interface.
 // It uses its internal LRU cache to "Get" and "Put". If a given git repo
 // is not in the cache, FetchRepo will place it at the top of the cache where
-// it will also be cloned to disk. See GitRepoLRUCache for details.
-func (lc *LRUCacheGitRepoProvider) FetchRepo(URL string) (GitRepo, error) {
+// it will also be cloned to disk. See GitRepoLRUCache for details. Every
+// branch and tag of the repo is only cloned or fetched if allBranches is set.
+func (lc *LRUCacheGitRepoProvider) FetchRepo(ctx context.Context, URL string, allBranches bool) (GitRepo, error) {
 	var err error
 
 	lc.logger.Debugf("Getting repo from LRU cache: %s", URL)
@@ -49,15 +51,16 @@ func (lc *LRUCacheGitRepoProvider) FetchRepo(URL string) (GitRepo, error) {
 	repoInCache := lc.LRUCache.Get(URL)
 	if repoInCache == nil {
 		lc.logger.Debugf("Cache miss. Putting to cache: %s", URL)
-		repoInCache, err = lc.LRUCache.Put(URL)
+		repoInCache, err = lc.LRUCache.Put(ctx, URL, allBranches)
 		if err != nil {
 			return nil, fmt.Errorf("could not put to the git repo LRU cache: %s", err.Error())
 		}
 	}
 
 	lc.logger.Debugf("Opening and fetching repo: %s", URL)
-	repo, err := repoInCache.OpenAndFetch()
+	repo, err := repoInCache.OpenAndFetch(ctx, allBranches)
 	if err != nil {
+		repoInCache.Done()
 		return nil, fmt.Errorf("could not open and fetch repo: %s", err.Error())
 	}
 
@@ -68,6 +71,13 @@ func (lc *LRUCacheGitRepoProvider) FetchRepo(URL string) (GitRepo, error) {
 	}, nil
 }
 
+// EvictRepo removes the git repo from the LRU cache and deletes it from disk,
+// regardless of the never evict repos. See GitRepoLRUCache.Evict.
+func (lc *LRUCacheGitRepoProvider) EvictRepo(URL string) error {
+	lc.logger.Debugf("Evicting repo from LRU cache: %s", URL)
+	return lc.LRUCache.Evict(URL)
+}
+
 // CachedGitRepo implements the GitRepo interface
 type CachedGitRepo struct {
 	url        string
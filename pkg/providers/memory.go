@@ -1,6 +1,7 @@
 package providers
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/go-git/go-git/v5"
@@ -22,11 +23,20 @@ func NewInMemoryGitRepoProvider(logger *zap.SugaredLogger) GitRepoProvider {
 	}
 }
 
-// FetchRepo clones the configured repository into memory
-func (im *InMemoryGitRepoProvider) FetchRepo(URL string) (GitRepo, error) {
-	inMemRepo, err := git.Clone(memory.NewStorage(), nil, &git.CloneOptions{
+// FetchRepo clones the configured repository into memory. Only the default
+// branch is cloned unless allBranches is set, in which case every branch and
+// tag is cloned, since every branch of a large repo may not fit in memory.
+// Cloning is abandoned once the context is done.
+func (im *InMemoryGitRepoProvider) FetchRepo(ctx context.Context, URL string, allBranches bool) (GitRepo, error) {
+	tags := git.NoTags
+	if allBranches {
+		tags = git.AllTags
+	}
+
+	inMemRepo, err := git.CloneContext(ctx, memory.NewStorage(), nil, &git.CloneOptions{
 		URL:          URL,
-		SingleBranch: true,
+		SingleBranch: !allBranches,
+		Tags:         tags,
 	})
 
 	if err != nil {
@@ -39,6 +49,12 @@ func (im *InMemoryGitRepoProvider) FetchRepo(URL string) (GitRepo, error) {
 	}, nil
 }
 
+// EvictRepo is a no-op for the in-memory git provider since repos are cloned
+// from scratch for every fetch
+func (im *InMemoryGitRepoProvider) EvictRepo(_ string) error {
+	return nil
+}
+
 // InMemoryGitRepo satisfies and implements the GitRepo interface
 type InMemoryGitRepo struct {
 	url  string
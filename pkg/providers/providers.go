@@ -1,13 +1,24 @@
 package providers
 
-import "github.com/go-git/go-git/v5"
+import (
+	"context"
+
+	"github.com/go-git/go-git/v5"
+)
 
 // GitRepoProvider is an API for accessing git repositories.
 // Different implementers of GitRepoProvider may
 type GitRepoProvider interface {
 	// FetchRepo is a single interface to acquire a GitRepo based on a provided
-	// URL. Different
-	FetchRepo(URL string) (GitRepo, error)
+	// URL. Different implementers may clone or fetch the repo, which is
+	// abandoned once the context is done. Only the default branch of the
+	// repo needs to be fetched unless allBranches is set, in which case every
+	// branch and tag is fetched.
+	FetchRepo(ctx context.Context, URL string, allBranches bool) (GitRepo, error)
+
+	// EvictRepo removes any copy of the git repository with the provided URL
+	// held by the provider so that it is fetched from scratch next time.
+	EvictRepo(URL string) error
 }
 
 // GitRepo wraps individual git repositories with the necessary internal methods
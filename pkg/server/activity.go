@@ -0,0 +1,83 @@
+package server
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/open-sauced/pizza/oven/pkg/api"
+)
+
+// handleRepoActivity returns the commit activity time series of a repo from
+// its daily commit activity rollup
+func (p PizzaOvenServer) handleRepoActivity(w http.ResponseWriter, r *http.Request, repoID int) {
+	query := r.URL.Query()
+	granularity := api.GranularityDay
+	if s := query.Get("granularity"); s != "" {
+		granularity = api.Granularity(s)
+	}
+
+	if !granularity.Valid() {
+		http.Error(w, fmt.Sprintf("invalid granularity, expected one of day, week, month or year: %s", granularity), http.StatusBadRequest)
+		return
+	}
+
+	since, err := parseTime(query, "since")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	until, err := parseTime(query, "until")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, err = p.PizzaOven.GetRepositoryURL(r.Context(), repoID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, fmt.Sprintf("Could not find repo: %d", repoID), http.StatusNotFound)
+			return
+		}
+
+		p.Logger.Errorf("Could not fetch repo %d: %s", repoID, err.Error())
+		http.Error(w, "Could not fetch repo", http.StatusInternalServerError)
+		return
+	}
+
+	buckets, err := p.PizzaOven.GetCommitActivity(r.Context(), repoID, granularity, since, until)
+	if err != nil {
+		p.Logger.Errorf("Could not query the commit activity of repo %d: %s", repoID, err.Error())
+		http.Error(w, "Could not query commit activity", http.StatusInternalServerError)
+		return
+	}
+
+	p.writeJSON(w, http.StatusOK, api.CommitActivity{
+		RepoID:      repoID,
+		Granularity: granularity,
+		Buckets:     buckets,
+	})
+}
+
+// utcDay returns the start of the UTC day of the given time
+func utcDay(t time.Time) time.Time {
+	year, month, day := t.UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// sortedDays returns the days of a set in chronological order
+func sortedDays(set map[time.Time]struct{}) []time.Time {
+	days := make([]time.Time, 0, len(set))
+	for day := range set {
+		days = append(days, day)
+	}
+
+	sort.Slice(days, func(i, j int) bool {
+		return days[i].Before(days[j])
+	})
+
+	return days
+}
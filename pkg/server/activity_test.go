@@ -0,0 +1,192 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+
+	"github.com/open-sauced/pizza/oven/pkg/api"
+	"github.com/open-sauced/pizza/oven/pkg/insights"
+	"github.com/open-sauced/pizza/oven/pkg/jobs"
+)
+
+func TestSortedUTCDays(t *testing.T) {
+	t.Parallel()
+
+	// 23:30 in UTC-5 is already the next day in UTC
+	est := time.FixedZone("EST", -5*60*60)
+	days := map[time.Time]struct{}{}
+	for _, when := range []time.Time{
+		time.Date(2023, time.March, 2, 23, 30, 0, 0, est),
+		time.Date(2023, time.March, 1, 8, 0, 0, 0, time.UTC),
+		time.Date(2023, time.March, 3, 1, 0, 0, 0, time.UTC),
+		time.Date(2023, time.March, 1, 22, 0, 0, 0, time.UTC),
+	} {
+		days[utcDay(when)] = struct{}{}
+	}
+
+	expected := []time.Time{
+		time.Date(2023, time.March, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2023, time.March, 3, 0, 0, 0, 0, time.UTC),
+	}
+
+	sorted := sortedDays(days)
+	if len(sorted) != len(expected) {
+		t.Fatalf("days: %v are not expected: %v", sorted, expected)
+	}
+
+	for i := range expected {
+		if !sorted[i].Equal(expected[i]) {
+			t.Fatalf("days: %v are not expected: %v", sorted, expected)
+		}
+	}
+}
+
+// repoActivity is a convenience method for testing that requests the commit
+// activity of the given repoID with the given query
+func repoActivity(t *testing.T, p *PizzaOvenServer, repoID int, query string) []api.ActivityBucket {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	p.handleRepo(w, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/repos/%d/activity?%s", repoID, query), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("activity status: %d is not expected: %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	var activity api.CommitActivity
+	if err := json.NewDecoder(w.Body).Decode(&activity); err != nil {
+		t.Fatalf("unexpected err decoding activity: %s", err.Error())
+	}
+
+	return activity.Buckets
+}
+
+func TestRepoActivity(t *testing.T) {
+	p := testPizzaOvenServer(t)
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatalf("unexpected err initializing repo: %s", err.Error())
+	}
+
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("unexpected err getting worktree: %s", err.Error())
+	}
+
+	// 23:30 in UTC-5 is already the next day in UTC
+	est := time.FixedZone("EST", -5*60*60)
+	testCommit(t, w, "monday", time.Date(2023, time.February, 27, 10, 0, 0, 0, time.UTC))
+	testCommit(t, w, "wednesday", time.Date(2023, time.March, 1, 8, 0, 0, 0, time.UTC))
+	testCommit(t, w, "wednesday evening", time.Date(2023, time.March, 1, 23, 30, 0, 0, est))
+	testCommit(t, w, "two weeks later", time.Date(2023, time.March, 14, 12, 0, 0, 0, time.UTC))
+
+	repoURL := "file://" + dir
+	bake := func() {
+		t.Helper()
+
+		job, _, err := p.PizzaOven.InsertBakeJob(ctx, repoURL, jobs.Options{})
+		if err != nil {
+			t.Fatalf("unexpected err queueing job: %s", err.Error())
+		}
+
+		if !p.claimAndRunJob(0) {
+			t.Fatalf("did not claim queued job: %s", job.ID)
+		}
+	}
+
+	bake()
+	repoID, err := p.PizzaOven.GetRepositoryID(ctx, insights.CommitInsight{RepoURLSource: repoURL})
+	if err != nil {
+		t.Fatalf("unexpected err fetching repo id: %s", err.Error())
+	}
+	t.Cleanup(func() {
+		//nolint:errcheck
+		p.PizzaOven.DeleteRepository(ctx, repoID)
+	})
+
+	day := func(month time.Month, day int) time.Time {
+		return time.Date(2023, month, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		expected []api.ActivityBucket
+	}{
+		{
+			name:  "Days between since and until are backfilled",
+			query: "granularity=day&since=2023-03-01T00:00:00Z&until=2023-03-04T00:00:00Z",
+			expected: []api.ActivityBucket{
+				{Date: day(time.March, 1), Commits: 1},
+				{Date: day(time.March, 2), Commits: 1},
+				{Date: day(time.March, 3), Commits: 0},
+				{Date: day(time.March, 4), Commits: 0},
+			},
+		},
+		{
+			name:  "Weeks start on monday and are backfilled between commits",
+			query: "granularity=week",
+			expected: []api.ActivityBucket{
+				{Date: day(time.February, 27), Commits: 3},
+				{Date: day(time.March, 6), Commits: 0},
+				{Date: day(time.March, 13), Commits: 1},
+			},
+		},
+		{
+			name:  "Since and until bound the days that are counted",
+			query: "granularity=week&since=2023-03-01T00:00:00Z",
+			expected: []api.ActivityBucket{
+				{Date: day(time.February, 27), Commits: 2},
+				{Date: day(time.March, 6), Commits: 0},
+				{Date: day(time.March, 13), Commits: 1},
+			},
+		},
+		{
+			name:  "Months",
+			query: "granularity=month",
+			expected: []api.ActivityBucket{
+				{Date: day(time.February, 1), Commits: 1},
+				{Date: day(time.March, 1), Commits: 3},
+			},
+		},
+		{
+			name:  "Years",
+			query: "granularity=year",
+			expected: []api.ActivityBucket{
+				{Date: time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC), Commits: 4},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		buckets := repoActivity(t, p, repoID, tt.query)
+		if !reflect.DeepEqual(buckets, tt.expected) {
+			t.Errorf("%s: buckets: %v are not expected: %v", tt.name, buckets, tt.expected)
+		}
+	}
+
+	// Incremental bakes refresh the rollup of the days they index commits on
+	testCommit(t, w, "second week", time.Date(2023, time.March, 8, 9, 0, 0, 0, time.UTC))
+	bake()
+
+	expected := []api.ActivityBucket{
+		{Date: day(time.February, 27), Commits: 3},
+		{Date: day(time.March, 6), Commits: 1},
+		{Date: day(time.March, 13), Commits: 1},
+	}
+
+	buckets := repoActivity(t, p, repoID, "granularity=week")
+	if !reflect.DeepEqual(buckets, expected) {
+		t.Fatalf("buckets: %v are not expected: %v", buckets, expected)
+	}
+}
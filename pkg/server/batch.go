@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/open-sauced/pizza/oven/pkg/jobs"
+)
+
+const (
+	// maxBatchRepos is the maximum number of repos in a batch bake request
+	maxBatchRepos = 1000
+
+	// batchValidationWorkers is the number of repo URLs of a batch that are
+	// validated against their remote concurrently
+	batchValidationWorkers = 8
+)
+
+// batchReqData is the request body of a batch bake. Each repo is given by its
+// URL along with its optional bake options.
+type batchReqData struct {
+	Repos []batchRepo `json:"repos"`
+}
+
+type batchRepo struct {
+	URL string `json:"url"`
+	jobs.Options
+}
+
+// batchResult is the outcome of a repo of a batch bake. Accepted repos
+// reference the job that was queued, or the active job they were attached to,
+// while rejected repos include the reason they were rejected.
+type batchResult struct {
+	URL      string    `json:"url"`
+	Accepted bool      `json:"accepted"`
+	Job      *jobs.Job `json:"job,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+type batchResponse struct {
+	Accepted int           `json:"accepted"`
+	Rejected int           `json:"rejected"`
+	Results  []batchResult `json:"results"`
+}
+
+func (p PizzaOvenServer) handleBatchRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		p.Logger.Errorf("Received batch request with invalid method: %s", r.Method)
+		http.Error(w, "Invalid request method, expected post", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if p.rejectIfDraining(w) {
+		return
+	}
+
+	var data batchReqData
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		p.Logger.Errorf("Could not decode batch request json body: %v", err)
+		http.Error(w, "Could not decode request body", http.StatusBadRequest)
+		return
+	}
+
+	if len(data.Repos) == 0 || len(data.Repos) > maxBatchRepos {
+		http.Error(w, fmt.Sprintf("Expected between 1 and %d repos, got: %d", maxBatchRepos, len(data.Repos)), http.StatusBadRequest)
+		return
+	}
+
+	// Validating a URL lists the refs of its remote, so the repos are
+	// validated and queued concurrently. A rejected repo does not affect the
+	// others in the batch.
+	results := make([]batchResult, len(data.Repos))
+	sem := make(chan struct{}, batchValidationWorkers)
+	var wg sync.WaitGroup
+	for i, repo := range data.Repos {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, repo batchRepo) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = p.queueBatchRepo(r.Context(), repo, r.RemoteAddr)
+		}(i, repo)
+	}
+	wg.Wait()
+
+	response := batchResponse{Results: results}
+	for _, result := range results {
+		if result.Accepted {
+			response.Accepted++
+		} else {
+			response.Rejected++
+		}
+	}
+
+	p.Logger.Debugf("Batch bake accepted %d and rejected %d repos", response.Accepted, response.Rejected)
+	p.writeJSON(w, http.StatusAccepted, response)
+}
+
+// queueBatchRepo validates and queues a bake job for a repo of a batch
+func (p PizzaOvenServer) queueBatchRepo(ctx context.Context, repo batchRepo, remoteAddr string) batchResult {
+	result := batchResult{URL: repo.URL}
+
+	repoURL, err := p.validateRepoURL(ctx, repo.URL)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	err = repo.Options.Validate()
+	if err != nil {
+		p.Logger.Debugf("Invalid bake options for repo %s: %s", repo.URL, err.Error())
+		result.Error = fmt.Sprintf("invalid bake options: %s", err.Error())
+		return result
+	}
+
+	job, err := p.queueBakeJob(ctx, repoURL, repo.Options, "", remoteAddr)
+	if err != nil {
+		result.Error = "could not queue bake job"
+		return result
+	}
+
+	result.Accepted = true
+	result.Job = job
+	return result
+}
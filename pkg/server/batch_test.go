@@ -0,0 +1,74 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestHandleBatchRequestRejections(t *testing.T) {
+	t.Parallel()
+
+	p := PizzaOvenServer{Logger: zap.NewNop().Sugar()}
+	missingRepo := "file://" + filepath.Join(t.TempDir(), "missing")
+
+	tests := []struct {
+		name           string
+		body           string
+		expectStatus   int
+		expectRejected []string
+	}{
+		{
+			name:           "Invalid repos are rejected individually",
+			body:           `{"repos": [{"url": "ftp://example.com/repo"}, {"url": "` + missingRepo + `", "stats": true}]}`,
+			expectStatus:   http.StatusAccepted,
+			expectRejected: []string{"ftp://example.com/repo", missingRepo},
+		},
+		{
+			name:         "Empty batch",
+			body:         `{"repos": []}`,
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			name:         "Malformed body",
+			body:         `["https://github.com/open-sauced/pizza"]`,
+			expectStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			p.handleBatchRequest(w, httptest.NewRequest(http.MethodPost, "/bake/batch", strings.NewReader(tt.body)))
+
+			if w.Code != tt.expectStatus {
+				t.Fatalf("status: %d is not expected: %d", w.Code, tt.expectStatus)
+			}
+
+			if tt.expectStatus != http.StatusAccepted {
+				return
+			}
+
+			var response batchResponse
+			err := json.NewDecoder(w.Body).Decode(&response)
+			if err != nil {
+				t.Fatalf("unexpected err decoding response: %s", err.Error())
+			}
+
+			if response.Accepted != 0 || response.Rejected != len(tt.expectRejected) || len(response.Results) != len(tt.expectRejected) {
+				t.Fatalf("response: %+v is not expected to reject: %v", response, tt.expectRejected)
+			}
+
+			for i, result := range response.Results {
+				if result.URL != tt.expectRejected[i] || result.Accepted || result.Job != nil || result.Error == "" {
+					t.Fatalf("result %d: %+v is not expected to reject: %s", i, result, tt.expectRejected[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/open-sauced/pizza/oven/pkg/jobs"
+)
+
+const (
+	// callbackAttempts is the number of times a callback is sent before
+	// giving up on it
+	callbackAttempts = 5
+
+	// callbackBackoff is how long to wait before retrying a failed callback.
+	// The wait is doubled after each failed attempt.
+	callbackBackoff = 2 * time.Second
+
+	// callbackTimeout is how long a callback receiver has to respond
+	callbackTimeout = 10 * time.Second
+
+	// callbackSignatureHeader holds the HMAC-SHA256 of the callback body
+	// using the configured callback secret
+	callbackSignatureHeader = "X-Pizza-Signature-256"
+)
+
+// callbackPayload is the body of the callback sent when a bake job finishes
+type callbackPayload struct {
+	JobID           string      `json:"job_id"`
+	RepoID          int         `json:"repo_id,omitempty"`
+	RepoURL         string      `json:"url"`
+	Status          jobs.Status `json:"status"`
+	CommitsInserted int64       `json:"commits_inserted"`
+	NewAuthors      int64       `json:"new_authors"`
+	DurationMs      int64       `json:"duration_ms"`
+	Error           string      `json:"error,omitempty"`
+}
+
+// validateCallbackURL checks that a callback URL is an absolute http(s) URL
+func validateCallbackURL(callbackURL string) error {
+	u, err := url.Parse(callbackURL)
+	if err != nil {
+		return fmt.Errorf("invalid callback URL: %s", err.Error())
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid callback URL, expected an absolute http or https URL: %s", callbackURL)
+	}
+
+	return nil
+}
+
+// notifyCallbacks sends the result of a finished job to every callback URL
+// that was registered for it
+func (p PizzaOvenServer) notifyCallbacks(job *jobs.Job, result bakeResult, duration time.Duration) {
+	ctx, cancel := queueContext()
+	defer cancel()
+
+	callbackURLs, err := p.PizzaOven.GetBakeJobCallbacks(ctx, job.ID)
+	if err != nil {
+		p.Logger.Errorf("Could not fetch callbacks of bake job %s: %s", job.ID, err.Error())
+		return
+	}
+
+	if len(callbackURLs) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(callbackPayload{
+		JobID:           job.ID,
+		RepoID:          result.repoID,
+		RepoURL:         job.RepoURL,
+		Status:          job.Status,
+		CommitsInserted: job.CommitsInserted,
+		NewAuthors:      result.authorsInserted,
+		DurationMs:      duration.Milliseconds(),
+		Error:           job.Error,
+	})
+	if err != nil {
+		p.Logger.Errorf("Could not encode callback of bake job %s: %s", job.ID, err.Error())
+		return
+	}
+
+	// Callbacks are abandoned along with the in-flight bakes once they have
+	// not finished within the shutdown timeout
+	for _, callbackURL := range callbackURLs {
+		err := p.sendCallback(p.bakeCtx, callbackURL, body, callbackBackoff)
+		if err != nil {
+			p.Logger.Errorf("Could not send callback of bake job %s to %s: %s", job.ID, callbackURL, err.Error())
+			continue
+		}
+
+		p.Logger.Debugf("Sent callback of bake job %s to: %s", job.ID, callbackURL)
+	}
+}
+
+// notifyCallbacksInBackground notifies the callbacks of a finished job without
+// holding up the worker, since callbacks are retried with backoff. They are
+// counted as in-flight so that shutdown waits for them to be sent. Once
+// shutdown is waiting for the in-flight bakes, the callbacks are notified by
+// the worker itself instead, which shutdown is already waiting for.
+func (p PizzaOvenServer) notifyCallbacksInBackground(job *jobs.Job, result bakeResult, duration time.Duration) {
+	if !p.bakes.add() {
+		p.notifyCallbacks(job, result, duration)
+		return
+	}
+
+	go func() {
+		defer p.bakes.done()
+		p.notifyCallbacks(job, result, duration)
+	}()
+}
+
+// sendCallback posts the signed body to the callback URL. Failed attempts are
+// retried with exponential backoff, starting with the given backoff, unless
+// the receiver rejects the callback with a client error. Sending is abandoned
+// once the context is done.
+func (p PizzaOvenServer) sendCallback(ctx context.Context, callbackURL string, body []byte, backoff time.Duration) error {
+	mac := hmac.New(sha256.New, []byte(p.Config.CallbackSecret))
+	//nolint:errcheck
+	mac.Write(body)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	client := &http.Client{
+		Timeout: callbackTimeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	var err error
+	for attempt := 1; attempt <= callbackAttempts; attempt++ {
+		if attempt > 1 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return fmt.Errorf("gave up after %d attempts: %s", attempt-1, ctx.Err().Error())
+			case <-timer.C:
+			}
+
+			backoff *= 2
+		}
+
+		var retry bool
+		retry, err = postCallback(ctx, client, callbackURL, body, signature)
+		if err == nil || !retry {
+			return err
+		}
+
+		p.Logger.Debugf("Callback attempt %d of %d to %s failed: %s", attempt, callbackAttempts, callbackURL, err.Error())
+	}
+
+	return fmt.Errorf("gave up after %d attempts: %s", callbackAttempts, err.Error())
+}
+
+// postCallback makes a single attempt at posting a callback. The returned bool
+// is true if a failed attempt may be retried.
+func postCallback(ctx context.Context, client *http.Client, callbackURL string, body []byte, signature string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(callbackSignatureHeader, signature)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+
+	//nolint:errcheck
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return true, fmt.Errorf("receiver responded with status: %d", resp.StatusCode)
+	default:
+		return false, fmt.Errorf("receiver rejected callback with status: %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestSendCallback(t *testing.T) {
+	t.Parallel()
+
+	secret := "pizza"
+	body := []byte(`{"job_id":"5b1d7a4e-0f7e-4c31-9d55-0e8a8d0b2f63","status":"succeeded"}`)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	expectSignature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		name           string
+		statuses       []int
+		expectErr      bool
+		expectAttempts int32
+	}{
+		{
+			name:           "Delivered on first attempt",
+			statuses:       []int{http.StatusOK},
+			expectAttempts: 1,
+		},
+		{
+			name:           "Retried after server errors",
+			statuses:       []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusNoContent},
+			expectAttempts: 3,
+		},
+		{
+			name:           "Not retried after client error",
+			statuses:       []int{http.StatusBadRequest, http.StatusOK},
+			expectErr:      true,
+			expectAttempts: 1,
+		},
+		{
+			name:           "Gives up after every attempt failed",
+			statuses:       []int{500, 500, 500, 500, 500, 200},
+			expectErr:      true,
+			expectAttempts: callbackAttempts,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var attempts int32
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempt := atomic.AddInt32(&attempts, 1)
+
+				received, err := io.ReadAll(r.Body)
+				if err != nil || string(received) != string(body) {
+					t.Errorf("received body: %s is not expected: %s", received, body)
+				}
+
+				if signature := r.Header.Get(callbackSignatureHeader); signature != expectSignature {
+					t.Errorf("signature: %s is not expected: %s", signature, expectSignature)
+				}
+
+				w.WriteHeader(tt.statuses[attempt-1])
+			}))
+			defer receiver.Close()
+
+			p := PizzaOvenServer{
+				Logger: zap.NewNop().Sugar(),
+				Config: &Config{CallbackSecret: secret},
+			}
+
+			err := p.sendCallback(context.Background(), receiver.URL, body, time.Millisecond)
+			if tt.expectErr && err == nil {
+				t.Fatalf("expected err sending callback, got none")
+			}
+
+			if !tt.expectErr && err != nil {
+				t.Fatalf("unexpected err sending callback: %s", err.Error())
+			}
+
+			if attempts != tt.expectAttempts {
+				t.Fatalf("attempts: %d is not expected: %d", attempts, tt.expectAttempts)
+			}
+		})
+	}
+}
+
+func TestSendCallbackCancelled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var attempts int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		cancel()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	p := PizzaOvenServer{
+		Logger: zap.NewNop().Sugar(),
+		Config: &Config{CallbackSecret: "pizza"},
+	}
+
+	// Retries are abandoned once the context is done rather than after the
+	// backoff has elapsed
+	done := make(chan error)
+	go func() {
+		done <- p.sendCallback(ctx, receiver.URL, []byte(`{}`), time.Hour)
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatalf("expected err sending callback, got none")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("callback was not abandoned once the context was done")
+	}
+
+	if attempts != 1 {
+		t.Fatalf("attempts: %d is not expected: 1", attempts)
+	}
+}
+
+func TestValidateCallbackURL(t *testing.T) {
+	t.Parallel()
+
+	for callbackURL, valid := range map[string]bool{
+		"https://api.opensauced.pizza/callbacks/bake": true,
+		"http://localhost:3000/bake":                  true,
+		"ftp://api.opensauced.pizza/callbacks":        false,
+		"/callbacks/bake":                             false,
+		"https://":                                    false,
+	} {
+		err := validateCallbackURL(callbackURL)
+		if valid && err != nil {
+			t.Fatalf("unexpected err validating callback URL %s: %s", callbackURL, err.Error())
+		}
+
+		if !valid && err == nil {
+			t.Fatalf("expected err validating callback URL %s, got none", callbackURL)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/open-sauced/pizza/oven/pkg/jobs"
+)
+
+// eventsKeepAliveInterval is how often a comment is sent on an idle event
+// stream so proxies do not close it
+const eventsKeepAliveInterval = 15 * time.Second
+
+// handleJobEvents streams the progress of a job as server-sent events until it
+// has finished, or until the server begins shutting down, in which case the
+// client may reconnect to another instance. The job may be processed by any
+// worker sharing the bake queue, so its progress is polled from the database.
+// Each event contains the job:
+//   - "phase" when the job is claimed or moves on to another phase
+//   - "progress" when more commits have been walked in the current phase
+//   - "done" once the job has finished, after which the stream is closed
+func (p PizzaOvenServer) handleJobEvents(w http.ResponseWriter, r *http.Request, id string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	job, err := p.PizzaOven.GetBakeJob(r.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, fmt.Sprintf("Could not find job: %s", id), http.StatusNotFound)
+			return
+		}
+
+		p.Logger.Errorf("Could not fetch bake job %s: %s", id, err.Error())
+		http.Error(w, "Could not fetch job", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	ticker := time.NewTicker(jobWaitInterval)
+	defer ticker.Stop()
+
+	var last *jobs.Job
+	lastSentAt := time.Now()
+	for {
+		if event := jobEvent(last, job); event != "" {
+			if err := writeEvent(w, event, job); err != nil {
+				p.Logger.Debugf("Could not write event of bake job %s: %s", id, err.Error())
+				return
+			}
+
+			lastSentAt = time.Now()
+			last = job
+		} else if time.Since(lastSentAt) >= eventsKeepAliveInterval {
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+
+			lastSentAt = time.Now()
+		}
+
+		flusher.Flush()
+		if job.Status.IsFinished() {
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-p.draining:
+			return
+		case <-ticker.C:
+		}
+
+		job, err = p.PizzaOven.GetBakeJob(r.Context(), id)
+		if err != nil {
+			p.Logger.Errorf("Could not fetch bake job %s: %s", id, err.Error())
+			return
+		}
+	}
+}
+
+// jobEvent returns the name of the event to send for the current state of a
+// job given the last state that was sent, or an empty string if nothing
+// has changed
+func jobEvent(last *jobs.Job, job *jobs.Job) string {
+	switch {
+	case job.Status.IsFinished():
+		return "done"
+	case last == nil || last.Status != job.Status || last.Phase != job.Phase:
+		return "phase"
+	case last.PhaseCount != job.PhaseCount:
+		return "progress"
+	default:
+		return ""
+	}
+}
+
+// writeEvent writes a server-sent event with the job as its json data
+func writeEvent(w http.ResponseWriter, event string, job *jobs.Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
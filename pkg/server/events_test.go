@@ -0,0 +1,61 @@
+package server
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/open-sauced/pizza/oven/pkg/jobs"
+)
+
+func TestJobEvent(t *testing.T) {
+	t.Parallel()
+
+	queued := &jobs.Job{Status: jobs.StatusQueued}
+	walking := &jobs.Job{Status: jobs.StatusRunning, Phase: jobs.PhaseWalkingAuthors}
+	walked := &jobs.Job{Status: jobs.StatusRunning, Phase: jobs.PhaseWalkingAuthors, PhaseCount: 1200}
+	inserting := &jobs.Job{Status: jobs.StatusRunning, Phase: jobs.PhaseInsertingCommits}
+	done := &jobs.Job{Status: jobs.StatusSucceeded, Phase: jobs.PhaseDone}
+
+	tests := []struct {
+		name        string
+		last        *jobs.Job
+		job         *jobs.Job
+		expectEvent string
+	}{
+		{name: "First event", last: nil, job: queued, expectEvent: "phase"},
+		{name: "Claimed", last: queued, job: walking, expectEvent: "phase"},
+		{name: "Unchanged", last: walking, job: walking, expectEvent: ""},
+		{name: "More commits walked", last: walking, job: walked, expectEvent: "progress"},
+		{name: "Next phase", last: walked, job: inserting, expectEvent: "phase"},
+		{name: "Finished", last: inserting, job: done, expectEvent: "done"},
+		{name: "Already finished", last: nil, job: done, expectEvent: "done"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if event := jobEvent(tt.last, tt.job); event != tt.expectEvent {
+				t.Fatalf("event: %q is not expected: %q", event, tt.expectEvent)
+			}
+		})
+	}
+}
+
+func TestWriteEvent(t *testing.T) {
+	t.Parallel()
+
+	w := httptest.NewRecorder()
+	err := writeEvent(w, "progress", &jobs.Job{ID: "5b1d7a4e-0f7e-4c31-9d55-0e8a8d0b2f63", Phase: jobs.PhaseInsertingCommits, PhaseCount: 42})
+	if err != nil {
+		t.Fatalf("unexpected err writing event: %s", err.Error())
+	}
+
+	event := w.Body.String()
+	if !strings.HasPrefix(event, "event: progress\ndata: {") || !strings.HasSuffix(event, "}\n\n") {
+		t.Fatalf("event is not formatted as a server-sent event: %q", event)
+	}
+
+	if !strings.Contains(event, `"phase":"inserting_commits","phase_count":42`) {
+		t.Fatalf("event does not contain the progress of the job: %q", event)
+	}
+}
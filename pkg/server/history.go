@@ -0,0 +1,387 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/utils/merkletrie"
+
+	"github.com/open-sauced/pizza/oven/pkg/insights"
+	"github.com/open-sauced/pizza/oven/pkg/mailmap"
+)
+
+// reachableCommits returns the set of commit hashes reachable from any of the
+// given hashes. Empty hashes and commits that are not present in the
+// repository are skipped, so if none are present an empty set is returned.
+func reachableCommits(repo *git.Repository, hashes ...string) (map[plumbing.Hash]bool, error) {
+	reachable := make(map[plumbing.Hash]bool)
+	for _, hash := range hashes {
+		if hash == "" || reachable[plumbing.NewHash(hash)] {
+			continue
+		}
+
+		commit, err := repo.CommitObject(plumbing.NewHash(hash))
+		if err != nil {
+			if err == plumbing.ErrObjectNotFound {
+				continue
+			}
+
+			return nil, err
+		}
+
+		// Commits reachable from previous hashes have already been walked
+		// along with their history
+		err = object.NewCommitPreorderIter(commit, reachable, nil).ForEach(func(c *object.Commit) error {
+			reachable[c.Hash] = true
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return reachable, nil
+}
+
+// newCommitIter returns an iterator of the commits reachable from the given
+// heads. The history is not walked past any commit in the known set, so only
+// commits that are not reachable from any known commit are returned. Each
+// commit is returned once, even if it is reachable from multiple heads.
+func newCommitIter(repo *git.Repository, heads []plumbing.Hash, known map[plumbing.Hash]bool) (object.CommitIter, error) {
+	seen := make(map[plumbing.Hash]bool, len(known))
+	for hash := range known {
+		seen[hash] = true
+	}
+
+	iters := make([]object.CommitIter, 0, len(heads))
+	for _, head := range heads {
+		commit, err := repo.CommitObject(head)
+		if err != nil {
+			return nil, err
+		}
+
+		iters = append(iters, object.NewCommitPreorderIter(commit, seen, nil))
+	}
+
+	return &multiHeadCommitIter{iters: iters, seen: seen}, nil
+}
+
+// multiHeadCommitIter walks the history of multiple heads in turn. Commits
+// returned while walking a head are added to the seen set shared by every
+// walk so that later heads do not walk them, or their history, again.
+type multiHeadCommitIter struct {
+	iters []object.CommitIter
+	seen  map[plumbing.Hash]bool
+}
+
+// Next returns the next commit which has not yet been seen
+func (m *multiHeadCommitIter) Next() (*object.Commit, error) {
+	for len(m.iters) > 0 {
+		c, err := m.iters[0].Next()
+		if err == io.EOF {
+			m.iters[0].Close()
+			m.iters = m.iters[1:]
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		m.seen[c.Hash] = true
+		return c, nil
+	}
+
+	return nil, io.EOF
+}
+
+// ForEach calls the given callback for each remaining commit. Iteration stops
+// without error if the callback returns storer.ErrStop.
+func (m *multiHeadCommitIter) ForEach(cb func(*object.Commit) error) error {
+	defer m.Close()
+
+	for {
+		c, err := m.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		err = cb(c)
+		if err == storer.ErrStop {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Close releases the remaining walks
+func (m *multiHeadCommitIter) Close() {
+	for _, iter := range m.iters {
+		iter.Close()
+	}
+
+	m.iters = nil
+}
+
+// isRewrittenHistory returns true if the history of the repo has been
+// rewritten since the given last indexed hash, i.e. the last indexed commit is
+// not an ancestor of the new head. If the last indexed commit is no longer
+// present in the repository, its history is assumed to have been rewritten.
+func isRewrittenHistory(repo *git.Repository, lastIndexedHash string, head plumbing.Hash) (bool, error) {
+	if lastIndexedHash == "" {
+		return false, nil
+	}
+
+	lastIndexed, err := repo.CommitObject(plumbing.NewHash(lastIndexedHash))
+	if err != nil {
+		if err == plumbing.ErrObjectNotFound {
+			return true, nil
+		}
+
+		return false, err
+	}
+
+	headCommit, err := repo.CommitObject(head)
+	if err != nil {
+		return false, err
+	}
+
+	isAncestor, err := lastIndexed.IsAncestor(headCommit)
+	if err != nil {
+		return false, err
+	}
+
+	return !isAncestor, nil
+}
+
+// reachableHeads returns the commits whose history is still reachable after a
+// repo's history has been rewritten: the given heads walked by the bake, the
+// targets of the refs indexed by earlier bakes of all refs and the refs and
+// commits baked by earlier targeted bakes. Bakes of all refs walk every
+// current ref of the repo, so the refs indexed earlier are not included and
+// targeted refs that no longer exist are skipped.
+//
+// Bakes of only HEAD may not have fetched the other refs of the repo. If the
+// history of an indexed or targeted ref can not be walked, false is returned
+// as the reachable commits can not be determined.
+func reachableHeads(repo *git.Repository, heads []plumbing.Hash, storedRefs []insights.RefInsight, targets []string, allRefs bool) ([]plumbing.Hash, bool, error) {
+	reachable := append([]plumbing.Hash{}, heads...)
+
+	if !allRefs {
+		for _, ref := range storedRefs {
+			hash := plumbing.NewHash(ref.TargetHash)
+			_, err := repo.CommitObject(hash)
+			if err == plumbing.ErrObjectNotFound {
+				return nil, false, nil
+			}
+			if err != nil {
+				return nil, false, err
+			}
+
+			reachable = append(reachable, hash)
+		}
+	}
+
+	for _, target := range targets {
+		hash, err := resolveRef(repo, target)
+		if err == nil {
+			_, err = repo.CommitObject(hash)
+		}
+
+		switch {
+		case err == nil:
+			reachable = append(reachable, hash)
+		case err != plumbing.ErrReferenceNotFound && err != plumbing.ErrObjectNotFound:
+			return nil, false, err
+		case !allRefs:
+			return nil, false, nil
+		}
+	}
+
+	return reachable, true, nil
+}
+
+// reconcileHeads returns the commits whose history is still reachable after
+// the history of the given repo has been rewritten. See reachableHeads.
+func (p PizzaOvenServer) reconcileHeads(ctx context.Context, repo *git.Repository, heads []plumbing.Hash, repoID int, repoURL string, allRefs bool) ([]plumbing.Hash, bool, error) {
+	storedRefs := []insights.RefInsight{}
+	if !allRefs {
+		var err error
+		storedRefs, err = p.PizzaOven.GetRefs(ctx, repoID)
+		if err != nil {
+			return nil, false, fmt.Errorf("could not fetch the indexed refs: %s", err.Error())
+		}
+	}
+
+	targets, err := p.PizzaOven.ListTargetedBakeRefs(ctx, repoURL)
+	if err != nil {
+		return nil, false, fmt.Errorf("could not fetch the targeted refs: %s", err.Error())
+	}
+
+	return reachableHeads(repo, heads, storedRefs, targets, allRefs)
+}
+
+// reconcileRewrittenHistory marks or deletes, depending on the configured
+// rewritten history mode, the commits of the given repo that are no longer
+// reachable from any of its indexed heads within the provided transaction.
+func (p PizzaOvenServer) reconcileRewrittenHistory(ctx context.Context, txn *sql.Tx, repo *git.Repository, heads []plumbing.Hash, repoID int, tmpTableName string) (int64, error) {
+	hashes := make([]string, 0, len(heads))
+	for _, head := range heads {
+		hashes = append(hashes, head.String())
+	}
+
+	reachable, err := reachableCommits(repo, hashes...)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt, err := p.PizzaOven.PrepareBulkReachableCommitInsert(ctx, txn, tmpTableName)
+	if err != nil {
+		return 0, err
+	}
+
+	for hash := range reachable {
+		err = p.PizzaOven.InsertReachableCommit(ctx, stmt, hash.String())
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	deleteUnreachable := p.Config.RewrittenHistoryMode == RewrittenHistoryDelete
+	return p.PizzaOven.ReconcileUnreachableCommits(ctx, txn, stmt, tmpTableName, repoID, deleteUnreachable)
+}
+
+// buildMailmap returns the mailmap used to resolve the canonical identities
+// of the commit authors of a repo. The ".mailmap" at the given head of the repo
+// is merged with the server-wide mailmap, which takes precedence. A missing or
+// invalid ".mailmap" in the repo is not an error.
+func (p PizzaOvenServer) buildMailmap(repo *git.Repository, head plumbing.Hash, repoURL string) *mailmap.Mailmap {
+	identities := mailmap.New()
+
+	headCommit, err := repo.CommitObject(head)
+	if err != nil {
+		p.Logger.Warnf("Could not read HEAD commit for mailmap of %s: %s", repoURL, err.Error())
+	} else {
+		repoMailmap, err := mailmap.FromCommit(headCommit)
+		if err != nil {
+			p.Logger.Warnf("Ignoring invalid .mailmap of %s: %s", repoURL, err.Error())
+		}
+
+		identities.Merge(repoMailmap)
+	}
+
+	identities.Merge(p.Config.Mailmap)
+	return identities
+}
+
+// commitFileChanges returns the line and file changes made by the given commit
+// compared to its parent. Root commits are compared to an empty tree. Merge
+// commits have no changes of their own, like "git log --stat", so that the
+// changes they merge are not counted twice. Diffing is abandoned once the
+// context is done.
+func commitFileChanges(ctx context.Context, c *object.Commit) ([]insights.FileChange, error) {
+	if c.NumParents() > 1 {
+		return []insights.FileChange{}, nil
+	}
+
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	parentTree := &object.Tree{}
+	if c.NumParents() == 1 {
+		parent, err := c.Parent(0)
+		if err != nil {
+			return nil, err
+		}
+
+		parentTree, err = parent.Tree()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	changes, err := object.DiffTreeWithOptions(ctx, parentTree, tree, object.DefaultDiffTreeOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	fileChanges := make([]insights.FileChange, 0, len(changes))
+	for _, change := range changes {
+		action, err := change.Action()
+		if err != nil {
+			return nil, err
+		}
+
+		fileChange := insights.FileChange{Path: change.To.Name}
+		switch action {
+		case merkletrie.Insert:
+			fileChange.ChangeType = insights.FileAdded
+		case merkletrie.Delete:
+			fileChange.Path = change.From.Name
+			fileChange.ChangeType = insights.FileDeleted
+		default:
+			fileChange.ChangeType = insights.FileModified
+			if change.From.Name != change.To.Name {
+				fileChange.PreviousPath = change.From.Name
+				fileChange.ChangeType = insights.FileRenamed
+			}
+		}
+
+		patch, err := change.PatchContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, stat := range patch.Stats() {
+			fileChange.Additions += stat.Addition
+			fileChange.Deletions += stat.Deletion
+		}
+
+		fileChanges = append(fileChanges, fileChange)
+	}
+
+	return fileChanges, nil
+}
+
+// insertCommitFileChanges walks the commits yielded by the given iterator and
+// copies their file changes into the bulk file change statement until the
+// context is done
+func (p PizzaOvenServer) insertCommitFileChanges(ctx context.Context, stmt *sql.Stmt, iter object.CommitIter) error {
+	return iter.ForEach(func(c *object.Commit) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		fileChanges, err := commitFileChanges(ctx, c)
+		if err != nil {
+			return fmt.Errorf("could not compute file changes of commit %s: %s", c.Hash.String(), err.Error())
+		}
+
+		// Commits without any file changes are still recorded so that their
+		// statistics are set to zero
+		if len(fileChanges) == 0 {
+			return p.PizzaOven.InsertFileChange(ctx, stmt, c.Hash.String(), nil)
+		}
+
+		for i := range fileChanges {
+			err = p.PizzaOven.InsertFileChange(ctx, stmt, c.Hash.String(), &fileChanges[i])
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,451 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/open-sauced/pizza/oven/pkg/insights"
+)
+
+// testCommit is a convenience method for testing that creates an empty commit
+// in the given worktree with the provided commit date and parents
+func testCommit(t *testing.T, w *git.Worktree, msg string, when time.Time, parents ...plumbing.Hash) plumbing.Hash {
+	t.Helper()
+
+	signature := &object.Signature{
+		Name:  "Pizza Tester",
+		Email: "tester@opensauced.pizza",
+		When:  when,
+	}
+
+	hash, err := w.Commit(msg, &git.CommitOptions{
+		AllowEmptyCommits: true,
+		Author:            signature,
+		Committer:         signature,
+		Parents:           parents,
+	})
+	if err != nil {
+		t.Fatalf("unexpected err creating commit: %s", err.Error())
+	}
+
+	return hash
+}
+
+// collectCommits is a convenience method for testing that returns the set of
+// hashes yielded by the given iterator
+func collectCommits(t *testing.T, iter object.CommitIter) map[plumbing.Hash]bool {
+	t.Helper()
+
+	commits := make(map[plumbing.Hash]bool)
+	err := iter.ForEach(func(c *object.Commit) error {
+		commits[c.Hash] = true
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected err iterating commits: %s", err.Error())
+	}
+
+	return commits
+}
+
+func TestNewCommitIter(t *testing.T) {
+	repo, err := git.PlainInit(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("unexpected err initializing repo: %s", err.Error())
+	}
+
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("unexpected err getting worktree: %s", err.Error())
+	}
+
+	now := time.Now()
+
+	// a -- b (last indexed) -- c (backdated) -- m
+	//  \                                       /
+	//   e (branched from a) ------------------
+	a := testCommit(t, w, "a", now.Add(-4*time.Hour))
+	b := testCommit(t, w, "b", now.Add(-3*time.Hour), a)
+	c := testCommit(t, w, "c", now.Add(-48*time.Hour), b)
+	e := testCommit(t, w, "e", now.Add(-2*time.Hour), a)
+	m := testCommit(t, w, "m", now.Add(-time.Hour), c, e)
+
+	tests := []struct {
+		name        string
+		knownHashes []string
+		heads       []plumbing.Hash
+		expected    []plumbing.Hash
+	}{
+		{
+			name:        "Walks entire history when nothing has been indexed",
+			knownHashes: []string{""},
+			heads:       []plumbing.Hash{m},
+			expected:    []plumbing.Hash{a, b, c, e, m},
+		},
+		{
+			name:        "Walks entire history when last indexed commit is missing",
+			knownHashes: []string{"0123456789012345678901234567890123456789"},
+			heads:       []plumbing.Hash{m},
+			expected:    []plumbing.Hash{a, b, c, e, m},
+		},
+		{
+			name:        "Walks only new commits regardless of commit dates",
+			knownHashes: []string{b.String()},
+			heads:       []plumbing.Hash{m},
+			expected:    []plumbing.Hash{c, e, m},
+		},
+		{
+			name:        "Walks nothing when HEAD has been indexed",
+			knownHashes: []string{m.String()},
+			heads:       []plumbing.Hash{m},
+			expected:    []plumbing.Hash{},
+		},
+		{
+			name:        "Walks each commit once from multiple heads",
+			knownHashes: []string{""},
+			heads:       []plumbing.Hash{c, e, m},
+			expected:    []plumbing.Hash{a, b, c, e, m},
+		},
+		{
+			name:        "Walks only new commits of multiple heads",
+			knownHashes: []string{b.String(), e.String()},
+			heads:       []plumbing.Hash{c, e},
+			expected:    []plumbing.Hash{c},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			known, err := reachableCommits(repo, tt.knownHashes...)
+			if err != nil {
+				t.Fatalf("unexpected err collecting known commits: %s", err.Error())
+			}
+
+			iter, err := newCommitIter(repo, tt.heads, known)
+			if err != nil {
+				t.Fatalf("unexpected err building commit iterator: %s", err.Error())
+			}
+
+			commits := collectCommits(t, iter)
+			if len(commits) != len(tt.expected) {
+				t.Fatalf("walked %d commits, expected %d", len(commits), len(tt.expected))
+			}
+
+			for _, hash := range tt.expected {
+				if !commits[hash] {
+					t.Fatalf("expected commit %s was not walked", hash.String())
+				}
+			}
+		})
+	}
+}
+
+func TestIsRewrittenHistory(t *testing.T) {
+	repo, err := git.PlainInit(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("unexpected err initializing repo: %s", err.Error())
+	}
+
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("unexpected err getting worktree: %s", err.Error())
+	}
+
+	now := time.Now()
+
+	// a -- b (force-pushed away)
+	//  \
+	//   c (rewritten HEAD)
+	a := testCommit(t, w, "a", now.Add(-3*time.Hour))
+	b := testCommit(t, w, "b", now.Add(-2*time.Hour), a)
+	c := testCommit(t, w, "c", now.Add(-time.Hour), a)
+
+	tests := []struct {
+		name            string
+		lastIndexedHash string
+		head            plumbing.Hash
+		expected        bool
+	}{
+		{
+			name:            "Not rewritten when nothing has been indexed",
+			lastIndexedHash: "",
+			head:            c,
+			expected:        false,
+		},
+		{
+			name:            "Not rewritten when last indexed commit is an ancestor",
+			lastIndexedHash: a.String(),
+			head:            b,
+			expected:        false,
+		},
+		{
+			name:            "Rewritten when last indexed commit is not an ancestor",
+			lastIndexedHash: b.String(),
+			head:            c,
+			expected:        true,
+		},
+		{
+			name:            "Rewritten when last indexed commit is missing",
+			lastIndexedHash: "0123456789012345678901234567890123456789",
+			head:            c,
+			expected:        true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rewritten, err := isRewrittenHistory(repo, tt.lastIndexedHash, tt.head)
+			if err != nil {
+				t.Fatalf("unexpected err: %s", err.Error())
+			}
+
+			if rewritten != tt.expected {
+				t.Fatalf("rewritten: %t is not expected: %t", rewritten, tt.expected)
+			}
+		})
+	}
+}
+
+func TestReachableHeads(t *testing.T) {
+	repo, err := git.PlainInit(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("unexpected err initializing repo: %s", err.Error())
+	}
+
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("unexpected err getting worktree: %s", err.Error())
+	}
+
+	now := time.Now()
+
+	// a -- b (force-pushed away)
+	// |\
+	// | c (rewritten HEAD)
+	//  \
+	//   s (only on side branch)
+	a := testCommit(t, w, "a", now.Add(-4*time.Hour))
+	b := testCommit(t, w, "b", now.Add(-3*time.Hour), a)
+	c := testCommit(t, w, "c", now.Add(-2*time.Hour), a)
+	s := testCommit(t, w, "s", now.Add(-time.Hour), a)
+
+	err = repo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName("side"), s))
+	if err != nil {
+		t.Fatalf("unexpected err creating branch: %s", err.Error())
+	}
+
+	sideRef := insights.RefInsight{Name: "side", Type: insights.RefBranch, TargetHash: s.String()}
+	missingRef := insights.RefInsight{Name: "gone", Type: insights.RefBranch, TargetHash: "0123456789012345678901234567890123456789"}
+
+	tests := []struct {
+		name       string
+		storedRefs []insights.RefInsight
+		targets    []string
+		allRefs    bool
+		ok         bool
+		expected   map[plumbing.Hash]bool
+	}{
+		{
+			name:     "Only HEAD is reachable without other refs",
+			ok:       true,
+			expected: map[plumbing.Hash]bool{a: true, c: true},
+		},
+		{
+			name:       "Side branch indexed by a bake of all refs is reachable",
+			storedRefs: []insights.RefInsight{sideRef},
+			ok:         true,
+			expected:   map[plumbing.Hash]bool{a: true, c: true, s: true},
+		},
+		{
+			name:     "Side branch baked by a targeted bake is reachable",
+			targets:  []string{"side"},
+			ok:       true,
+			expected: map[plumbing.Hash]bool{a: true, c: true, s: true},
+		},
+		{
+			name:     "Commit baked by a targeted bake is reachable",
+			targets:  []string{s.String()},
+			ok:       true,
+			expected: map[plumbing.Hash]bool{a: true, c: true, s: true},
+		},
+		{
+			name:       "Unknown when an indexed ref was not fetched",
+			storedRefs: []insights.RefInsight{sideRef, missingRef},
+			ok:         false,
+		},
+		{
+			name:    "Unknown when a targeted ref was not fetched",
+			targets: []string{"gone"},
+			ok:      false,
+		},
+		{
+			name:       "Refs indexed earlier are ignored by bakes of all refs",
+			storedRefs: []insights.RefInsight{sideRef, missingRef},
+			targets:    []string{"gone"},
+			allRefs:    true,
+			ok:         true,
+			expected:   map[plumbing.Hash]bool{a: true, c: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			heads, ok, err := reachableHeads(repo, []plumbing.Hash{c}, tt.storedRefs, tt.targets, tt.allRefs)
+			if err != nil {
+				t.Fatalf("unexpected err: %s", err.Error())
+			}
+
+			if ok != tt.ok {
+				t.Fatalf("ok: %t is not expected: %t", ok, tt.ok)
+			}
+
+			if !ok {
+				return
+			}
+
+			hashes := make([]string, 0, len(heads))
+			for _, head := range heads {
+				hashes = append(hashes, head.String())
+			}
+
+			reachable, err := reachableCommits(repo, hashes...)
+			if err != nil {
+				t.Fatalf("unexpected err: %s", err.Error())
+			}
+
+			if reachable[b] {
+				t.Fatalf("force-pushed away commit: %s is reachable", b)
+			}
+
+			if len(reachable) != len(tt.expected) {
+				t.Fatalf("reachable commits: %v are not expected: %v", reachable, tt.expected)
+			}
+
+			for hash := range tt.expected {
+				if !reachable[hash] {
+					t.Fatalf("expected commit: %s to be reachable", hash)
+				}
+			}
+		})
+	}
+}
+
+// testWriteFile is a convenience method for testing that writes and stages a
+// file with the given contents in the provided worktree
+func testWriteFile(t *testing.T, w *git.Worktree, path string, contents string) {
+	t.Helper()
+
+	err := util.WriteFile(w.Filesystem, path, []byte(contents), 0o644)
+	if err != nil {
+		t.Fatalf("unexpected err writing file: %s", err.Error())
+	}
+
+	_, err = w.Add(path)
+	if err != nil {
+		t.Fatalf("unexpected err staging file: %s", err.Error())
+	}
+}
+
+func TestCommitFileChanges(t *testing.T) {
+	repo, err := git.PlainInit(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("unexpected err initializing repo: %s", err.Error())
+	}
+
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("unexpected err getting worktree: %s", err.Error())
+	}
+
+	now := time.Now()
+
+	testWriteFile(t, w, "README.md", "pizza\n")
+	testWriteFile(t, w, "main.go", "package main\n")
+	root := testCommit(t, w, "root", now.Add(-3*time.Hour))
+
+	testWriteFile(t, w, "README.md", "pizza\noven\n")
+	_, err = w.Remove("main.go")
+	if err != nil {
+		t.Fatalf("unexpected err removing file: %s", err.Error())
+	}
+	modified := testCommit(t, w, "modified", now.Add(-2*time.Hour), root)
+
+	empty := testCommit(t, w, "empty", now.Add(-time.Hour), modified)
+	merge := testCommit(t, w, "merge", now, empty, root)
+
+	tests := []struct {
+		name     string
+		hash     plumbing.Hash
+		expected map[string]insights.FileChange
+	}{
+		{
+			name: "Root commit is compared to an empty tree",
+			hash: root,
+			expected: map[string]insights.FileChange{
+				"README.md": {Path: "README.md", Additions: 1, ChangeType: insights.FileAdded},
+				"main.go":   {Path: "main.go", Additions: 1, ChangeType: insights.FileAdded},
+			},
+		},
+		{
+			name: "Commit is compared to its parent",
+			hash: modified,
+			expected: map[string]insights.FileChange{
+				"README.md": {Path: "README.md", Additions: 1, ChangeType: insights.FileModified},
+				"main.go":   {Path: "main.go", Deletions: 1, ChangeType: insights.FileDeleted},
+			},
+		},
+		{
+			name:     "Empty commit has no changes",
+			hash:     empty,
+			expected: map[string]insights.FileChange{},
+		},
+		{
+			name:     "Merge commit has no changes",
+			hash:     merge,
+			expected: map[string]insights.FileChange{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := repo.CommitObject(tt.hash)
+			if err != nil {
+				t.Fatalf("unexpected err getting commit: %s", err.Error())
+			}
+
+			changes, err := commitFileChanges(context.Background(), c)
+			if err != nil {
+				t.Fatalf("unexpected err computing file changes: %s", err.Error())
+			}
+
+			if len(changes) != len(tt.expected) {
+				t.Fatalf("got %d file changes, expected %d", len(changes), len(tt.expected))
+			}
+
+			for _, change := range changes {
+				if change != tt.expected[change.Path] {
+					t.Fatalf("file change: %+v is not expected: %+v", change, tt.expected[change.Path])
+				}
+			}
+		})
+	}
+
+	// Diffing is abandoned once the context is done
+	c, err := repo.CommitObject(modified)
+	if err != nil {
+		t.Fatalf("unexpected err getting commit: %s", err.Error())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := commitFileChanges(ctx, c); err == nil {
+		t.Fatalf("expected err computing file changes with a cancelled context")
+	}
+}
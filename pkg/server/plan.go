@@ -0,0 +1,202 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/open-sauced/pizza/oven/pkg/insights"
+	"github.com/open-sauced/pizza/oven/pkg/jobs"
+)
+
+// bakePlan describes which commits of a repo are walked by a bake and how
+// the incremental state of the repo is updated afterwards
+type bakePlan struct {
+	// heads are the commits whose history is walked
+	heads []plumbing.Hash
+
+	// known are the commits which, along with their history, are not walked
+	known map[plumbing.Hash]bool
+
+	// since and until bound the commit dates of the walked commits
+	since *time.Time
+	until *time.Time
+
+	// upToDate is true if there is nothing to walk
+	upToDate bool
+
+	// rewritten is true if commits that were previously indexed may no longer
+	// be reachable and must be reconciled
+	rewritten bool
+
+	// refs and refUpdates are the current refs of the repo and the refs whose
+	// commits must be recorded when indexing all refs
+	refs       []insights.RefInsight
+	refUpdates []refUpdate
+
+	// targeted is true if the incremental state of the repo must not be
+	// updated by the bake
+	targeted bool
+}
+
+// commitIter returns an iterator of the commits walked by the plan. Date
+// windows are applied the same way as git.LogOptions' Since and Until.
+func (b *bakePlan) commitIter(repo *git.Repository) (object.CommitIter, error) {
+	iter, err := newCommitIter(repo, b.heads, b.known)
+	if err != nil {
+		return nil, err
+	}
+
+	if b.since != nil || b.until != nil {
+		limitOptions := object.LogLimitOptions{Since: b.since, Until: b.until}
+		iter = object.NewCommitLimitIterFromIter(iter, limitOptions)
+	}
+
+	return iter, nil
+}
+
+// planIncrementalBake plans a bake which walks the commits of the repo that
+// have not been indexed since its last bake. When indexing all refs, the
+// history of every remote branch and tag is walked in addition to HEAD. A
+// forced bake ignores the last bake and walks the entire history.
+func (p PizzaOvenServer) planIncrementalBake(ctx context.Context, repo *git.Repository, repoID int, head plumbing.Hash, opts jobs.Options, repoURL string) (*bakePlan, error) {
+	var err error
+	lastIndexedHash := ""
+	if !opts.Force {
+		p.Logger.Debugf("Getting last indexed HEAD in DB: %s", repoURL)
+		lastIndexedHash, err = p.PizzaOven.GetLastIndexedHash(ctx, repoID)
+		if err != nil {
+			return nil, fmt.Errorf("could not fetch the last indexed HEAD: %s", err.Error())
+		}
+	}
+
+	plan := &bakePlan{heads: []plumbing.Hash{head}}
+	knownHashes := []string{lastIndexedHash}
+	refsRemoved := false
+	if opts.AllRefs {
+		p.Logger.Debugf("Inspecting the branches and tags of the git repo: %s", repoURL)
+		plan.refs, err = repoRefs(repo)
+		if err != nil {
+			return nil, fmt.Errorf("could not read the refs of the git repo: %s", err.Error())
+		}
+
+		storedRefs := []insights.RefInsight{}
+		if !opts.Force {
+			storedRefs, err = p.PizzaOven.GetRefs(ctx, repoID)
+			if err != nil {
+				return nil, fmt.Errorf("could not fetch the indexed refs: %s", err.Error())
+			}
+		}
+
+		plan.refUpdates, refsRemoved, err = diffRefs(repo, plan.refs, storedRefs)
+		if err != nil {
+			return nil, fmt.Errorf("could not compare the refs to the indexed refs: %s", err.Error())
+		}
+
+		plan.heads = append(plan.heads, refHeads(plan.refs)...)
+		for _, storedRef := range storedRefs {
+			knownHashes = append(knownHashes, storedRef.TargetHash)
+		}
+	}
+
+	if lastIndexedHash == head.String() && len(plan.refUpdates) == 0 && !refsRemoved {
+		p.Logger.Debugf("HEAD %s has already been indexed, nothing to do: %s", lastIndexedHash, repoURL)
+		plan.upToDate = true
+		return plan, nil
+	}
+
+	plan.rewritten, err = isRewrittenHistory(repo, lastIndexedHash, head)
+	if err != nil {
+		return nil, fmt.Errorf("could not determine if the history has been rewritten: %s", err.Error())
+	}
+
+	if plan.rewritten {
+		p.Logger.Warnf("History of %s has been rewritten: last indexed HEAD %s is not an ancestor of HEAD %s", repoURL, lastIndexedHash, head.String())
+	}
+
+	// Commits only reachable from a rewritten or deleted ref must also be
+	// reconciled
+	for _, update := range plan.refUpdates {
+		if update.rewritten {
+			p.Logger.Warnf("History of %s %s of %s has been rewritten", update.ref.Type, update.ref.Name, repoURL)
+			plan.rewritten = true
+		}
+	}
+	plan.rewritten = plan.rewritten || refsRemoved
+
+	// Commits reachable from the last indexed HEAD, and the last indexed refs,
+	// have already been indexed and are skipped when walking the history from
+	// the new heads. Unlike filtering on commit dates, this finds exactly the
+	// new commits regardless of their timestamps (i.e., rebased or
+	// cherry-picked commits).
+	p.Logger.Debugf("Collecting known commits from %d last indexed heads: %s", len(knownHashes), repoURL)
+	plan.known, err = reachableCommits(repo, knownHashes...)
+	if err != nil {
+		return nil, fmt.Errorf("could not collect the known commits: %s", err.Error())
+	}
+
+	return plan, nil
+}
+
+// planTargetedBake plans a bake of the ref, commit range or date window given
+// in the options. Commits that have already been indexed are walked again and
+// skipped when they are inserted, and the incremental state of the repo is
+// left untouched.
+func planTargetedBake(repo *git.Repository, head plumbing.Hash, opts jobs.Options) (*bakePlan, error) {
+	plan := &bakePlan{
+		heads:    []plumbing.Hash{head},
+		since:    opts.Since,
+		until:    opts.Until,
+		targeted: true,
+	}
+
+	switch {
+	case opts.To != "":
+		plan.heads[0] = plumbing.NewHash(opts.To)
+	case opts.Ref != "":
+		hash, err := resolveRef(repo, opts.Ref)
+		if err != nil {
+			return nil, fmt.Errorf("could not resolve ref %s: %s", opts.Ref, err.Error())
+		}
+
+		plan.heads[0] = hash
+	}
+
+	if _, err := repo.CommitObject(plan.heads[0]); err != nil {
+		return nil, fmt.Errorf("could not find commit %s: %s", plan.heads[0].String(), err.Error())
+	}
+
+	plan.known = make(map[plumbing.Hash]bool)
+	if opts.From != "" {
+		if _, err := repo.CommitObject(plumbing.NewHash(opts.From)); err != nil {
+			return nil, fmt.Errorf("could not find commit %s: %s", opts.From, err.Error())
+		}
+
+		known, err := reachableCommits(repo, opts.From)
+		if err != nil {
+			return nil, fmt.Errorf("could not collect the commits reachable from %s: %s", opts.From, err.Error())
+		}
+
+		plan.known = known
+	}
+
+	return plan, nil
+}
+
+// resolveRef resolves a branch, tag or commit hash of the repo to a commit.
+// Branches that only exist on the origin remote may be given by their name.
+func resolveRef(repo *git.Repository, name string) (plumbing.Hash, error) {
+	hash, err := repo.ResolveRevision(plumbing.Revision(name))
+	if err == plumbing.ErrReferenceNotFound {
+		hash, err = repo.ResolveRevision(plumbing.Revision(plumbing.NewRemoteReferenceName(git.DefaultRemoteName, name)))
+	}
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return *hash, nil
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/open-sauced/pizza/oven/pkg/jobs"
+)
+
+func TestPlanTargetedBake(t *testing.T) {
+	repo, err := git.PlainInit(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("unexpected err initializing repo: %s", err.Error())
+	}
+
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("unexpected err getting worktree: %s", err.Error())
+	}
+
+	now := time.Now()
+
+	// a -- b -- c (master)
+	//       \
+	//        d (feature)
+	a := testCommit(t, w, "a", now.Add(-4*time.Hour))
+	b := testCommit(t, w, "b", now.Add(-3*time.Hour), a)
+	d := testCommit(t, w, "d", now.Add(-2*time.Hour), b)
+	c := testCommit(t, w, "c", now.Add(-time.Hour), b)
+
+	err = repo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName("feature"), d))
+	if err != nil {
+		t.Fatalf("unexpected err creating branch: %s", err.Error())
+	}
+
+	since := now.Add(-150 * time.Minute)
+	until := now.Add(-90 * time.Minute)
+
+	tests := []struct {
+		name     string
+		opts     jobs.Options
+		expected []plumbing.Hash
+	}{
+		{
+			name:     "Walks the history of a branch",
+			opts:     jobs.Options{Ref: "feature"},
+			expected: []plumbing.Hash{a, b, d},
+		},
+		{
+			name:     "Walks the history of a commit hash",
+			opts:     jobs.Options{Ref: b.String()},
+			expected: []plumbing.Hash{a, b},
+		},
+		{
+			name:     "Walks a commit range",
+			opts:     jobs.Options{From: a.String(), To: d.String()},
+			expected: []plumbing.Hash{b, d},
+		},
+		{
+			name:     "Walks a commit range ending at HEAD",
+			opts:     jobs.Options{From: b.String()},
+			expected: []plumbing.Hash{c},
+		},
+		{
+			name:     "Walks a date window",
+			opts:     jobs.Options{Ref: "feature", Since: &since, Until: &until},
+			expected: []plumbing.Hash{d},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := planTargetedBake(repo, c, tt.opts)
+			if err != nil {
+				t.Fatalf("unexpected err planning bake: %s", err.Error())
+			}
+
+			if !plan.targeted {
+				t.Fatalf("targeted bake plan would update the incremental state of the repo")
+			}
+
+			iter, err := plan.commitIter(repo)
+			if err != nil {
+				t.Fatalf("unexpected err building commit iterator: %s", err.Error())
+			}
+
+			commits := collectCommits(t, iter)
+			if len(commits) != len(tt.expected) {
+				t.Fatalf("walked %d commits, expected %d", len(commits), len(tt.expected))
+			}
+
+			for _, hash := range tt.expected {
+				if !commits[hash] {
+					t.Fatalf("expected commit %s was not walked", hash.String())
+				}
+			}
+		})
+	}
+
+	_, err = planTargetedBake(repo, c, jobs.Options{Ref: "missing"})
+	if err == nil {
+		t.Fatalf("expected error planning bake of a missing ref, got none")
+	}
+}
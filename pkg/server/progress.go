@@ -0,0 +1,71 @@
+package server
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/open-sauced/pizza/oven/pkg/database"
+	"github.com/open-sauced/pizza/oven/pkg/jobs"
+)
+
+// progressInterval is how often the running count of walked commits of a job
+// is recorded. Phase transitions are always recorded immediately.
+const progressInterval = time.Second
+
+// jobProgress records the progress of processing a job so that it may be
+// streamed to clients by any pizza oven instance. A nil jobProgress records
+// nothing.
+type jobProgress struct {
+	jobID     string
+	pizzaOven *database.PizzaOvenDbHandler
+	logger    *zap.SugaredLogger
+
+	phase      jobs.Phase
+	count      int64
+	recordedAt time.Time
+}
+
+// newJobProgress returns a jobProgress which records the progress of the job
+// with the given id
+func (p PizzaOvenServer) newJobProgress(jobID string) *jobProgress {
+	return &jobProgress{
+		jobID:     jobID,
+		pizzaOven: p.PizzaOven,
+		logger:    p.Logger,
+	}
+}
+
+// enter records that processing the job has moved on to the given phase
+func (j *jobProgress) enter(phase jobs.Phase) {
+	if j == nil {
+		return
+	}
+
+	j.phase = phase
+	j.count = 0
+	j.record()
+}
+
+// walked records that another commit has been walked in the current phase
+func (j *jobProgress) walked() {
+	if j == nil {
+		return
+	}
+
+	j.count++
+	if time.Since(j.recordedAt) >= progressInterval {
+		j.record()
+	}
+}
+
+func (j *jobProgress) record() {
+	ctx, cancel := queueContext()
+	defer cancel()
+
+	j.recordedAt = time.Now()
+	err := j.pizzaOven.UpdateBakeJobProgress(ctx, j.jobID, j.phase, j.count)
+	if err != nil {
+		j.logger.Errorf("Could not record progress of bake job %s: %s", j.jobID, err.Error())
+	}
+}
@@ -0,0 +1,228 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/open-sauced/pizza/oven/pkg/insights"
+)
+
+// refUpdate is a ref whose commits must be recorded because it is new or has
+// moved since the repo was last baked. Only the commits that are not reachable
+// from the previous hash of a fast-forwarded ref are walked. Refs that are
+// new or have been rewritten have no previous hash and are walked entirely.
+type refUpdate struct {
+	ref          insights.RefInsight
+	previousHash string
+	rewritten    bool
+}
+
+// repoRefs returns the remote branches and the tags of the given repo. Refs
+// that do not point to a commit, i.e. tags of trees or blobs, are skipped.
+func repoRefs(repo *git.Repository) ([]insights.RefInsight, error) {
+	iter, err := repo.References()
+	if err != nil {
+		return nil, err
+	}
+
+	refs := []insights.RefInsight{}
+	err = iter.ForEach(func(r *plumbing.Reference) error {
+		if r.Type() != plumbing.HashReference {
+			return nil
+		}
+
+		switch {
+		case r.Name().IsRemote():
+			// Only the branches of the origin remote are indexed
+			prefix := plumbing.NewRemoteReferenceName(git.DefaultRemoteName, "").String()
+			if !strings.HasPrefix(r.Name().String(), prefix) {
+				return nil
+			}
+
+			refs = append(refs, insights.RefInsight{
+				Name:       strings.TrimPrefix(r.Name().String(), prefix),
+				Type:       insights.RefBranch,
+				TargetHash: r.Hash().String(),
+			})
+		case r.Name().IsTag():
+			ref, ok, err := tagRef(repo, r)
+			if err != nil {
+				return err
+			}
+
+			if ok {
+				refs = append(refs, ref)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return refs, nil
+}
+
+// tagRef returns the given tag peeled to the commit it tags. The date of an
+// annotated tag is its tagger date while the date of a lightweight tag is the
+// date of its commit. False is returned if the tag does not tag a commit.
+func tagRef(repo *git.Repository, r *plumbing.Reference) (insights.RefInsight, bool, error) {
+	ref := insights.RefInsight{
+		Name: r.Name().Short(),
+		Type: insights.RefTag,
+	}
+
+	tag, err := repo.TagObject(r.Hash())
+	switch err {
+	case nil:
+		commit, err := tag.Commit()
+		if err == object.ErrUnsupportedObject {
+			return ref, false, nil
+		}
+		if err != nil {
+			return ref, false, err
+		}
+
+		ref.TargetHash = commit.Hash.String()
+		ref.TagDate = tag.Tagger.When
+		return ref, true, nil
+	case plumbing.ErrObjectNotFound:
+		commit, err := repo.CommitObject(r.Hash())
+		if err == plumbing.ErrObjectNotFound {
+			return ref, false, nil
+		}
+		if err != nil {
+			return ref, false, err
+		}
+
+		ref.TargetHash = commit.Hash.String()
+		ref.TagDate = commit.Committer.When
+		return ref, true, nil
+	default:
+		return ref, false, err
+	}
+}
+
+// diffRefs compares the current refs of a repo to the refs stored when it
+// was last baked. It returns the refs whose commits must be recorded and true
+// if any stored ref has been deleted since.
+func diffRefs(repo *git.Repository, refs []insights.RefInsight, storedRefs []insights.RefInsight) ([]refUpdate, bool, error) {
+	stored := make(map[insights.RefType]map[string]string)
+	for _, ref := range storedRefs {
+		if stored[ref.Type] == nil {
+			stored[ref.Type] = make(map[string]string)
+		}
+
+		stored[ref.Type][ref.Name] = ref.TargetHash
+	}
+
+	updates := []refUpdate{}
+	for _, ref := range refs {
+		previousHash, ok := stored[ref.Type][ref.Name]
+		delete(stored[ref.Type], ref.Name)
+
+		switch {
+		case !ok:
+			updates = append(updates, refUpdate{ref: ref})
+		case previousHash != ref.TargetHash:
+			rewritten, err := isRewrittenHistory(repo, previousHash, plumbing.NewHash(ref.TargetHash))
+			if err != nil {
+				return nil, false, err
+			}
+
+			if rewritten {
+				updates = append(updates, refUpdate{ref: ref, rewritten: true})
+			} else {
+				updates = append(updates, refUpdate{ref: ref, previousHash: previousHash})
+			}
+		}
+	}
+
+	removed := false
+	for _, names := range stored {
+		removed = removed || len(names) > 0
+	}
+
+	return updates, removed, nil
+}
+
+// indexRefs replaces the stored refs of the given repo with its current refs
+// and records the commits reachable from each of the updated refs within the
+// provided transaction. The commits must have already been inserted.
+func (p PizzaOvenServer) indexRefs(ctx context.Context, txn *sql.Tx, repo *git.Repository, repoID int, refs []insights.RefInsight, updates []refUpdate, refTmpTableName string, refCommitTmpTableName string) error {
+	// The previously recorded commits of a rewritten ref may no longer be
+	// reachable from it, so they are recorded again from scratch. This must
+	// happen before any bulk copy is started within the transaction.
+	for _, update := range updates {
+		if update.rewritten {
+			err := p.PizzaOven.DeleteRefCommits(ctx, txn, repoID, update.ref)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	refStmt, err := p.PizzaOven.PrepareBulkRefInsert(ctx, txn, refTmpTableName)
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		err = p.PizzaOven.InsertRef(ctx, refStmt, ref)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = p.PizzaOven.PivotTmpTableToRefsTable(ctx, txn, refStmt, refTmpTableName, repoID)
+	if err != nil {
+		return err
+	}
+
+	refCommitStmt, err := p.PizzaOven.PrepareBulkRefCommitInsert(ctx, txn, refCommitTmpTableName)
+	if err != nil {
+		return err
+	}
+
+	for _, update := range updates {
+		known, err := reachableCommits(repo, update.previousHash)
+		if err != nil {
+			return err
+		}
+
+		iter, err := newCommitIter(repo, []plumbing.Hash{plumbing.NewHash(update.ref.TargetHash)}, known)
+		if err != nil {
+			return err
+		}
+
+		err = iter.ForEach(func(c *object.Commit) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			return p.PizzaOven.InsertRefCommit(ctx, refCommitStmt, update.ref, c.Hash.String())
+		})
+		if err != nil {
+			return fmt.Errorf("could not record commits of %s %s: %s", update.ref.Type, update.ref.Name, err.Error())
+		}
+	}
+
+	return p.PizzaOven.PivotTmpTableToRefCommitsTable(ctx, txn, refCommitStmt, refCommitTmpTableName, repoID)
+}
+
+// refHeads returns the hashes of the commits the given refs point to
+func refHeads(refs []insights.RefInsight) []plumbing.Hash {
+	heads := make([]plumbing.Hash, 0, len(refs))
+	for _, ref := range refs {
+		heads = append(heads, plumbing.NewHash(ref.TargetHash))
+	}
+
+	return heads
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/open-sauced/pizza/oven/pkg/insights"
+)
+
+func TestRepoRefs(t *testing.T) {
+	upstreamDir := t.TempDir()
+	upstream, err := git.PlainInit(upstreamDir, false)
+	if err != nil {
+		t.Fatalf("unexpected err initializing upstream repo: %s", err.Error())
+	}
+
+	w, err := upstream.Worktree()
+	if err != nil {
+		t.Fatalf("unexpected err getting worktree: %s", err.Error())
+	}
+
+	now := time.Now().Truncate(time.Second)
+
+	// a (v0) -- b (master, v1)
+	//  \
+	//   c (release)
+	a := testCommit(t, w, "a", now.Add(-3*time.Hour))
+	b := testCommit(t, w, "b", now.Add(-2*time.Hour), a)
+	c := testCommit(t, w, "c", now.Add(-time.Hour), a)
+
+	for name, hash := range map[plumbing.ReferenceName]plumbing.Hash{
+		plumbing.Master: b,
+		plumbing.NewBranchReferenceName("release"): c,
+	} {
+		err = upstream.Storer.SetReference(plumbing.NewHashReference(name, hash))
+		if err != nil {
+			t.Fatalf("unexpected err setting branch %s: %s", name, err.Error())
+		}
+	}
+
+	_, err = upstream.CreateTag("v0", a, nil)
+	if err != nil {
+		t.Fatalf("unexpected err creating lightweight tag: %s", err.Error())
+	}
+
+	_, err = upstream.CreateTag("v1", b, &git.CreateTagOptions{
+		Message: "v1",
+		Tagger:  &object.Signature{Name: "Pizza Tester", Email: "tester@opensauced.pizza", When: now},
+	})
+	if err != nil {
+		t.Fatalf("unexpected err creating annotated tag: %s", err.Error())
+	}
+
+	repo, err := git.PlainClone(t.TempDir(), false, &git.CloneOptions{URL: upstreamDir, Tags: git.AllTags})
+	if err != nil {
+		t.Fatalf("unexpected err cloning upstream repo: %s", err.Error())
+	}
+
+	refs, err := repoRefs(repo)
+	if err != nil {
+		t.Fatalf("unexpected err reading refs: %s", err.Error())
+	}
+
+	expected := map[string]insights.RefInsight{
+		"master":  {Name: "master", Type: insights.RefBranch, TargetHash: b.String()},
+		"release": {Name: "release", Type: insights.RefBranch, TargetHash: c.String()},
+		"v0":      {Name: "v0", Type: insights.RefTag, TargetHash: a.String(), TagDate: now.Add(-3 * time.Hour)},
+		"v1":      {Name: "v1", Type: insights.RefTag, TargetHash: b.String(), TagDate: now},
+	}
+
+	if len(refs) != len(expected) {
+		t.Fatalf("got %d refs, expected %d: %+v", len(refs), len(expected), refs)
+	}
+
+	for _, ref := range refs {
+		e := expected[ref.Name]
+		if ref.Type != e.Type || ref.TargetHash != e.TargetHash || !ref.TagDate.Equal(e.TagDate) {
+			t.Fatalf("ref: %+v is not expected: %+v", ref, e)
+		}
+	}
+}
+
+func TestDiffRefs(t *testing.T) {
+	repo, err := git.PlainInit(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("unexpected err initializing repo: %s", err.Error())
+	}
+
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("unexpected err getting worktree: %s", err.Error())
+	}
+
+	now := time.Now()
+
+	// a -- b
+	//  \
+	//   c
+	a := testCommit(t, w, "a", now.Add(-3*time.Hour))
+	b := testCommit(t, w, "b", now.Add(-2*time.Hour), a)
+	c := testCommit(t, w, "c", now.Add(-time.Hour), a)
+
+	branch := func(name string, hash plumbing.Hash) insights.RefInsight {
+		return insights.RefInsight{Name: name, Type: insights.RefBranch, TargetHash: hash.String()}
+	}
+
+	tag := func(name string, hash plumbing.Hash) insights.RefInsight {
+		return insights.RefInsight{Name: name, Type: insights.RefTag, TargetHash: hash.String()}
+	}
+
+	tests := []struct {
+		name            string
+		refs            []insights.RefInsight
+		storedRefs      []insights.RefInsight
+		expected        []refUpdate
+		expectedRemoved bool
+	}{
+		{
+			name:       "Walks every ref entirely when nothing has been indexed",
+			refs:       []insights.RefInsight{branch("main", b), tag("v1", a)},
+			storedRefs: []insights.RefInsight{},
+			expected: []refUpdate{
+				{ref: branch("main", b)},
+				{ref: tag("v1", a)},
+			},
+		},
+		{
+			name:       "Skips unchanged refs",
+			refs:       []insights.RefInsight{branch("main", b), tag("v1", a)},
+			storedRefs: []insights.RefInsight{branch("main", b), tag("v1", a)},
+			expected:   []refUpdate{},
+		},
+		{
+			name:       "Walks only new commits of fast-forwarded refs",
+			refs:       []insights.RefInsight{branch("main", b)},
+			storedRefs: []insights.RefInsight{branch("main", a)},
+			expected: []refUpdate{
+				{ref: branch("main", b), previousHash: a.String()},
+			},
+		},
+		{
+			name:       "Walks rewritten refs entirely",
+			refs:       []insights.RefInsight{branch("main", c)},
+			storedRefs: []insights.RefInsight{branch("main", b)},
+			expected: []refUpdate{
+				{ref: branch("main", c), rewritten: true},
+			},
+		},
+		{
+			name:            "Detects removed refs",
+			refs:            []insights.RefInsight{branch("main", b)},
+			storedRefs:      []insights.RefInsight{branch("main", b), branch("feature", c), tag("main", b)},
+			expected:        []refUpdate{},
+			expectedRemoved: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updates, removed, err := diffRefs(repo, tt.refs, tt.storedRefs)
+			if err != nil {
+				t.Fatalf("unexpected err: %s", err.Error())
+			}
+
+			if removed != tt.expectedRemoved {
+				t.Fatalf("removed: %t is not expected: %t", removed, tt.expectedRemoved)
+			}
+
+			if len(updates) != len(tt.expected) {
+				t.Fatalf("got %d ref updates, expected %d: %+v", len(updates), len(tt.expected), updates)
+			}
+
+			for i, update := range updates {
+				if update != tt.expected[i] {
+					t.Fatalf("ref update: %+v is not expected: %+v", update, tt.expected[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,343 @@
+package server
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/open-sauced/pizza/oven/pkg/api"
+)
+
+// hashPrefixRegex matches an empty or partial commit hash
+var hashPrefixRegex = regexp.MustCompile(`^[0-9a-f]{0,40}$`)
+
+// deletedRepo is the response body of a repo deletion
+type deletedRepo struct {
+	ID             int    `json:"id"`
+	URL            string `json:"url"`
+	CommitsDeleted int64  `json:"commits_deleted"`
+}
+
+// handleRepos lists the baked repos
+func (p PizzaOvenServer) handleRepos(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		p.Logger.Errorf("Received repos request with invalid method: %s", r.Method)
+		http.Error(w, "Invalid request method, expected get", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	cursor, limit, err := parsePage(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := p.PizzaOven.ListRepositories(r.Context(), cursor, limit)
+	if err != nil {
+		p.Logger.Errorf("Could not list repos: %s", err.Error())
+		http.Error(w, "Could not list repos", http.StatusInternalServerError)
+		return
+	}
+
+	p.writeJSON(w, http.StatusOK, page)
+}
+
+// handleRepo routes the requests made for an individual repo by its id
+func (p PizzaOvenServer) handleRepo(w http.ResponseWriter, r *http.Request) {
+	segments := strings.Split(strings.TrimPrefix(r.URL.Path, "/repos/"), "/")
+	repoID, err := strconv.Atoi(segments[0])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case len(segments) == 1:
+		if r.Method != http.MethodDelete {
+			p.Logger.Errorf("Received repo request with invalid method: %s", r.Method)
+			http.Error(w, "Invalid request method, expected delete", http.StatusMethodNotAllowed)
+			return
+		}
+
+		p.handleDeleteRepo(w, r, repoID)
+	case len(segments) == 2 && segments[1] == "commits":
+		if r.Method != http.MethodGet {
+			p.Logger.Errorf("Received repo commits request with invalid method: %s", r.Method)
+			http.Error(w, "Invalid request method, expected get", http.StatusMethodNotAllowed)
+			return
+		}
+
+		p.handleRepoCommits(w, r, repoID)
+	case len(segments) == 2 && segments[1] == "activity":
+		if r.Method != http.MethodGet {
+			p.Logger.Errorf("Received repo activity request with invalid method: %s", r.Method)
+			http.Error(w, "Invalid request method, expected get", http.StatusMethodNotAllowed)
+			return
+		}
+
+		p.handleRepoActivity(w, r, repoID)
+	case len(segments) == 2 && segments[1] == "contributors":
+		if r.Method != http.MethodGet {
+			p.Logger.Errorf("Received repo contributors request with invalid method: %s", r.Method)
+			http.Error(w, "Invalid request method, expected get", http.StatusMethodNotAllowed)
+			return
+		}
+
+		p.handleRepoContributors(w, r, repoID)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleRepoCommits lists the commits of a repo
+func (p PizzaOvenServer) handleRepoCommits(w http.ResponseWriter, r *http.Request, repoID int) {
+	filter, err := parseCommitFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, err = p.PizzaOven.GetRepositoryURL(r.Context(), repoID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, fmt.Sprintf("Could not find repo: %d", repoID), http.StatusNotFound)
+			return
+		}
+
+		p.Logger.Errorf("Could not fetch repo %d: %s", repoID, err.Error())
+		http.Error(w, "Could not fetch repo", http.StatusInternalServerError)
+		return
+	}
+
+	filter.RepoID = repoID
+	p.writeCommitPage(w, r, filter)
+}
+
+// handleRepoContributors aggregates the commits of a repo per author
+func (p PizzaOvenServer) handleRepoContributors(w http.ResponseWriter, r *http.Request, repoID int) {
+	query := r.URL.Query()
+	since, err := parseTime(query, "since")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	until, err := parseTime(query, "until")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, err = p.PizzaOven.GetRepositoryURL(r.Context(), repoID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, fmt.Sprintf("Could not find repo: %d", repoID), http.StatusNotFound)
+			return
+		}
+
+		p.Logger.Errorf("Could not fetch repo %d: %s", repoID, err.Error())
+		http.Error(w, "Could not fetch repo", http.StatusInternalServerError)
+		return
+	}
+
+	stats, err := p.PizzaOven.GetContributorStats(r.Context(), repoID, since, until)
+	if err != nil {
+		p.Logger.Errorf("Could not aggregate the contributors of repo %d: %s", repoID, err.Error())
+		http.Error(w, "Could not aggregate contributors", http.StatusInternalServerError)
+		return
+	}
+
+	p.writeJSON(w, http.StatusOK, stats)
+}
+
+// handleAuthor routes the requests made for an individual commit author by
+// their id
+func (p PizzaOvenServer) handleAuthor(w http.ResponseWriter, r *http.Request) {
+	segments := strings.Split(strings.TrimPrefix(r.URL.Path, "/authors/"), "/")
+	authorID, err := strconv.Atoi(segments[0])
+	if err != nil || len(segments) != 2 || segments[1] != "commits" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		p.Logger.Errorf("Received author commits request with invalid method: %s", r.Method)
+		http.Error(w, "Invalid request method, expected get", http.StatusMethodNotAllowed)
+		return
+	}
+
+	filter, err := parseCommitFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, err = p.PizzaOven.GetAuthor(r.Context(), authorID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, fmt.Sprintf("Could not find author: %d", authorID), http.StatusNotFound)
+			return
+		}
+
+		p.Logger.Errorf("Could not fetch author %d: %s", authorID, err.Error())
+		http.Error(w, "Could not fetch author", http.StatusInternalServerError)
+		return
+	}
+
+	filter.AuthorID = authorID
+	p.writeCommitPage(w, r, filter)
+}
+
+// writeCommitPage queries the commits matching the filter and writes them as
+// the json body of the response
+func (p PizzaOvenServer) writeCommitPage(w http.ResponseWriter, r *http.Request, filter api.CommitFilter) {
+	page, err := p.PizzaOven.ListCommits(r.Context(), filter)
+	if err != nil {
+		p.Logger.Errorf("Could not list commits: %s", err.Error())
+		http.Error(w, "Could not list commits", http.StatusInternalServerError)
+		return
+	}
+
+	p.writeJSON(w, http.StatusOK, page)
+}
+
+// parsePage parses the "cursor" and "limit" query parameters used to paginate
+func parsePage(query url.Values) (*api.Cursor, int, error) {
+	var cursor *api.Cursor
+	var err error
+	if s := query.Get("cursor"); s != "" {
+		cursor, err = api.DecodeCursor(s)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	limit := api.DefaultPageLimit
+	if s := query.Get("limit"); s != "" {
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > api.MaxPageLimit {
+			return nil, 0, fmt.Errorf("invalid limit, expected a number between 1 and %d: %s", api.MaxPageLimit, s)
+		}
+	}
+
+	return cursor, limit, nil
+}
+
+// parseTime parses an optional RFC 3339 query parameter
+func parseTime(query url.Values, key string) (*time.Time, error) {
+	s := query.Get(key)
+	if s == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s, expected an RFC 3339 date: %s", key, s)
+	}
+
+	return &t, nil
+}
+
+// parseCommitFilter parses the query parameters used to filter and paginate
+// commits: "author" (email), "since", "until", "hash" (prefix), "cursor" and
+// "limit"
+func parseCommitFilter(query url.Values) (api.CommitFilter, error) {
+	var filter api.CommitFilter
+	var err error
+
+	filter.Cursor, filter.Limit, err = parsePage(query)
+	if err != nil {
+		return filter, err
+	}
+
+	filter.Since, err = parseTime(query, "since")
+	if err != nil {
+		return filter, err
+	}
+
+	filter.Until, err = parseTime(query, "until")
+	if err != nil {
+		return filter, err
+	}
+
+	filter.AuthorEmail = query.Get("author")
+
+	filter.HashPrefix = strings.ToLower(query.Get("hash"))
+	if !hashPrefixRegex.MatchString(filter.HashPrefix) {
+		return filter, fmt.Errorf("invalid hash, expected a hexadecimal commit hash prefix: %s", filter.HashPrefix)
+	}
+
+	return filter, nil
+}
+
+// handleDeleteRepo deletes a repo along with all of its commits and refs and
+// evicts it from the git provider. Repos that are being baked are not deleted.
+func (p PizzaOvenServer) handleDeleteRepo(w http.ResponseWriter, r *http.Request, repoID int) {
+	repoURL, err := p.PizzaOven.GetRepositoryURL(r.Context(), repoID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			p.Logger.Debugf("Could not find repo: %d", repoID)
+			http.Error(w, fmt.Sprintf("Could not find repo: %d", repoID), http.StatusNotFound)
+			return
+		}
+
+		p.Logger.Errorf("Could not fetch repo %d: %s", repoID, err.Error())
+		http.Error(w, "Could not fetch repo", http.StatusInternalServerError)
+		return
+	}
+
+	p.Logger.Infow("Repository deletion requested",
+		"audit", "delete_repo", "repo_id", repoID, "clone_url", repoURL, "remote_addr", r.RemoteAddr)
+
+	// Repos may not be deleted while they are being baked so the bake does
+	// not re-insert the commits that are being deleted
+	repoLock, err := p.PizzaOven.TryAcquireRepositoryLock(r.Context(), repoID)
+	if err != nil {
+		p.Logger.Errorf("Failed to acquire lock on repository %s: %s", repoURL, err.Error())
+		http.Error(w, "Could not delete repo", http.StatusInternalServerError)
+		return
+	}
+
+	if repoLock == nil {
+		p.Logger.Debugf("Could not delete repo %s while it is being baked", repoURL)
+		http.Error(w, fmt.Sprintf("Repo is being baked, try again later: %d", repoID), http.StatusConflict)
+		return
+	}
+	defer func() {
+		if err := repoLock.Release(); err != nil {
+			p.Logger.Errorf("Failed to release lock on repository %s: %s", repoURL, err.Error())
+		}
+	}()
+
+	commitsDeleted, err := p.PizzaOven.DeleteRepository(r.Context(), repoID)
+	if err != nil {
+		p.Logger.Errorf("Could not delete repo %s: %s", repoURL, err.Error())
+		http.Error(w, "Could not delete repo", http.StatusInternalServerError)
+		return
+	}
+
+	p.Logger.Infow("Deleted repository",
+		"audit", "delete_repo", "repo_id", repoID, "clone_url", repoURL, "commits_deleted", commitsDeleted)
+
+	err = p.PizzaGitProvider.EvictRepo(repoURL)
+	if err != nil {
+		p.Logger.Errorf("Could not evict deleted repo %s from the git provider: %s", repoURL, err.Error())
+		http.Error(w, "Repo was deleted but could not be evicted from the git provider", http.StatusInternalServerError)
+		return
+	}
+
+	p.Logger.Infow("Evicted repository from git provider",
+		"audit", "delete_repo", "repo_id", repoID, "clone_url", repoURL)
+
+	p.writeJSON(w, http.StatusOK, deletedRepo{
+		ID:             repoID,
+		URL:            repoURL,
+		CommitsDeleted: commitsDeleted,
+	})
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/open-sauced/pizza/oven/pkg/api"
+)
+
+func TestParseCommitFilter(t *testing.T) {
+	t.Parallel()
+
+	since := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	cursor := api.Cursor{Date: time.Date(2023, time.March, 2, 12, 0, 0, 0, time.UTC), ID: 1234}
+
+	tests := []struct {
+		name        string
+		query       string
+		expectErr   bool
+		expectLimit int
+		expectSince *time.Time
+		expectHash  string
+		expectEmail string
+		expectID    int64
+	}{
+		{
+			name:        "Defaults",
+			query:       "",
+			expectLimit: api.DefaultPageLimit,
+		},
+		{
+			name:        "All filters",
+			query:       "author=jane%40example.com&since=2023-01-01T00:00:00Z&hash=ABC123&limit=10&cursor=" + cursor.Encode(),
+			expectLimit: 10,
+			expectSince: &since,
+			expectHash:  "abc123",
+			expectEmail: "jane@example.com",
+			expectID:    cursor.ID,
+		},
+		{
+			name:      "Limit too large",
+			query:     "limit=501",
+			expectErr: true,
+		},
+		{
+			name:      "Limit not a number",
+			query:     "limit=ten",
+			expectErr: true,
+		},
+		{
+			name:      "Invalid date",
+			query:     "until=yesterday",
+			expectErr: true,
+		},
+		{
+			name:      "Invalid hash",
+			query:     "hash=abc%25",
+			expectErr: true,
+		},
+		{
+			name:      "Invalid cursor",
+			query:     "cursor=not-a-cursor",
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("unexpected err parsing query: %s", err.Error())
+			}
+
+			filter, err := parseCommitFilter(query)
+			if tt.expectErr {
+				if err == nil {
+					t.Fatalf("expected err parsing filter, got none")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected err parsing filter: %s", err.Error())
+			}
+
+			if filter.Limit != tt.expectLimit {
+				t.Fatalf("limit: %d is not expected: %d", filter.Limit, tt.expectLimit)
+			}
+
+			if (filter.Since == nil) != (tt.expectSince == nil) || (filter.Since != nil && !filter.Since.Equal(*tt.expectSince)) {
+				t.Fatalf("since: %v is not expected: %v", filter.Since, tt.expectSince)
+			}
+
+			if filter.HashPrefix != tt.expectHash {
+				t.Fatalf("hash prefix: %s is not expected: %s", filter.HashPrefix, tt.expectHash)
+			}
+
+			if filter.AuthorEmail != tt.expectEmail {
+				t.Fatalf("author email: %s is not expected: %s", filter.AuthorEmail, tt.expectEmail)
+			}
+
+			if (filter.Cursor == nil) != (tt.expectID == 0) || (filter.Cursor != nil && filter.Cursor.ID != tt.expectID) {
+				t.Fatalf("cursor: %+v is not expected to have id: %d", filter.Cursor, tt.expectID)
+			}
+		})
+	}
+}
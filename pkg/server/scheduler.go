@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"hash/fnv"
+	"time"
+
+	"github.com/open-sauced/pizza/oven/pkg/database"
+	"github.com/open-sauced/pizza/oven/pkg/jobs"
+)
+
+// scheduleCheckInterval is how often the scheduler checks for repos that are
+// due to be re-baked and, on instances that are not scheduling, how often
+// they attempt to take over scheduling
+const scheduleCheckInterval = time.Minute
+
+// startScheduler starts the scheduler if periodic bakes are configured. Every
+// instance runs a scheduler but only the one holding the scheduler lock
+// queues bakes, the others stand by in case it goes away.
+func (p PizzaOvenServer) startScheduler() {
+	if p.Config.ScheduleInterval <= 0 && len(p.Config.ScheduleRepoIntervals) == 0 {
+		return
+	}
+
+	p.Logger.Infof("Starting scheduler with interval %s, jitter %s and %d repo overrides",
+		p.Config.ScheduleInterval, p.Config.ScheduleJitter, len(p.Config.ScheduleRepoIntervals))
+	go p.scheduler()
+}
+
+// scheduler periodically queues bake jobs for the repos that are due. When
+// the server begins shutting down, it stops and releases the scheduler lock so
+// another instance may take over scheduling.
+func (p PizzaOvenServer) scheduler() {
+	ticker := time.NewTicker(scheduleCheckInterval)
+	defer ticker.Stop()
+
+	var lock *database.SchedulerLock
+	for {
+		// A round of scheduling is abandoned if it takes longer than the
+		// interval between rounds
+		ctx, cancel := context.WithTimeout(context.Background(), scheduleCheckInterval)
+		lock = p.scheduleDueRepos(ctx, lock)
+		cancel()
+
+		select {
+		case <-ticker.C:
+		case <-p.draining:
+			if lock != nil {
+				if err := lock.Release(); err != nil {
+					p.Logger.Errorf("Could not release the scheduler lock: %s", err.Error())
+				}
+			}
+
+			return
+		}
+	}
+}
+
+// scheduleDueRepos queues a bake job for each repo that is due to be re-baked
+// if this instance holds, or is able to acquire, the scheduler lock. The lock
+// that is held afterwards, if any, is returned.
+func (p PizzaOvenServer) scheduleDueRepos(ctx context.Context, lock *database.SchedulerLock) *database.SchedulerLock {
+	if lock != nil && !lock.Held(ctx) {
+		p.Logger.Warnf("Lost the scheduler lock, attempting to re-acquire it")
+		if err := lock.Release(); err != nil {
+			p.Logger.Debugf("Could not release the lost scheduler lock: %s", err.Error())
+		}
+
+		lock = nil
+	}
+
+	if lock == nil {
+		var err error
+		lock, err = p.PizzaOven.TryAcquireSchedulerLock(ctx)
+		if err != nil {
+			p.Logger.Errorf("Could not acquire the scheduler lock: %s", err.Error())
+			return nil
+		}
+
+		if lock == nil {
+			p.Logger.Debugf("Another instance holds the scheduler lock")
+			return nil
+		}
+
+		p.Logger.Infof("Acquired the scheduler lock, scheduling periodic bakes")
+	}
+
+	bakeTimes, err := p.PizzaOven.ListRepositoryBakeTimes(ctx)
+	if err != nil {
+		p.Logger.Errorf("Could not list the bake times of repos: %s", err.Error())
+		return lock
+	}
+
+	now := time.Now()
+	scheduled := 0
+	for _, bakeTime := range bakeTimes {
+		interval, ok := p.Config.ScheduleRepoIntervals[bakeTime.URL]
+		if !ok {
+			interval = p.Config.ScheduleInterval
+		}
+
+		if interval <= 0 || now.Before(nextScheduledBake(bakeTime, interval, p.Config.ScheduleJitter)) {
+			continue
+		}
+
+		// Scheduled bakes use the default options, the same as a bake
+		// requested with only a URL, so they coalesce with any such bake
+		// that is already active
+		job, created, err := p.PizzaOven.InsertBakeJob(ctx, bakeTime.URL, jobs.Options{})
+		if err != nil {
+			p.Logger.Errorf("Could not queue scheduled bake job for repo %s: %s", bakeTime.URL, err.Error())
+			continue
+		}
+
+		if created {
+			p.Logger.Debugf("Queued scheduled bake job %s for repo: %s", job.ID, job.RepoURL)
+			scheduled++
+		}
+	}
+
+	if scheduled > 0 {
+		p.Logger.Infof("Queued %d scheduled bake jobs", scheduled)
+		p.notifyWorkers()
+	}
+
+	return lock
+}
+
+// nextScheduledBake returns when a repo is next due to be re-baked. Repos
+// that have never been baked are due immediately. The jitter of each repo is
+// derived from its URL so the re-bakes of repos that were baked together are
+// spread out, and stay spread out, across the jitter.
+func nextScheduledBake(bakeTime database.RepositoryBakeTime, interval time.Duration, jitter time.Duration) time.Time {
+	if bakeTime.LastBakedAt == nil {
+		return time.Time{}
+	}
+
+	next := bakeTime.LastBakedAt.Add(interval)
+	if jitter > 0 {
+		h := fnv.New64a()
+		//nolint:errcheck
+		h.Write([]byte(bakeTime.URL))
+		next = next.Add(time.Duration(h.Sum64() % uint64(jitter)))
+	}
+
+	return next
+}
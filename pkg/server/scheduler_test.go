@@ -0,0 +1,41 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/open-sauced/pizza/oven/pkg/database"
+)
+
+func TestNextScheduledBake(t *testing.T) {
+	t.Parallel()
+
+	lastBakedAt := time.Date(2023, time.October, 10, 17, 0, 0, 0, time.UTC)
+	interval := 24 * time.Hour
+	jitter := time.Hour
+
+	never := database.RepositoryBakeTime{URL: "https://github.com/open-sauced/pizza"}
+	if next := nextScheduledBake(never, interval, jitter); !next.IsZero() {
+		t.Fatalf("repo that was never baked is not due immediately: %s", next)
+	}
+
+	baked := database.RepositoryBakeTime{URL: "https://github.com/open-sauced/pizza", LastBakedAt: &lastBakedAt}
+	if next := nextScheduledBake(baked, interval, 0); !next.Equal(lastBakedAt.Add(interval)) {
+		t.Fatalf("next bake without jitter: %s is not expected: %s", next, lastBakedAt.Add(interval))
+	}
+
+	next := nextScheduledBake(baked, interval, jitter)
+	if next.Before(lastBakedAt.Add(interval)) || !next.Before(lastBakedAt.Add(interval+jitter)) {
+		t.Fatalf("next bake: %s is not within the jitter of the interval", next)
+	}
+
+	if again := nextScheduledBake(baked, interval, jitter); !again.Equal(next) {
+		t.Fatalf("next bake: %s is not stable: %s", again, next)
+	}
+
+	// Repos baked at the same time are spread across the jitter
+	other := database.RepositoryBakeTime{URL: "https://github.com/open-sauced/insights", LastBakedAt: &lastBakedAt}
+	if otherNext := nextScheduledBake(other, interval, jitter); otherNext.Equal(next) {
+		t.Fatalf("repos baked at the same time are due at the same time: %s", next)
+	}
+}
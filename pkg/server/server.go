@@ -3,16 +3,19 @@
 package server
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
 	"strings"
 	"sync/atomic"
+	"syscall"
 	"time"
 
-	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/google/uuid"
@@ -21,50 +24,172 @@ import (
 	"github.com/open-sauced/pizza/oven/pkg/common"
 	"github.com/open-sauced/pizza/oven/pkg/database"
 	"github.com/open-sauced/pizza/oven/pkg/insights"
+	"github.com/open-sauced/pizza/oven/pkg/jobs"
+	"github.com/open-sauced/pizza/oven/pkg/mailmap"
 	"github.com/open-sauced/pizza/oven/pkg/providers"
+	"github.com/open-sauced/pizza/oven/pkg/webhooks"
 )
 
 // counter is a atomic counter that is used to create canonical, short lived
 // temporary table names for bulk inserts of commit authors
 var counter int64
 
+// maxCallbackAttachAttempts is the number of times another bake job is queued
+// for a callback when the job it was added to finishes first
+const maxCallbackAttachAttempts = 3
+
+// DefaultBakeWorkers is the number of bake workers started when the number
+// of workers is not configured
+const DefaultBakeWorkers = 4
+
+// DefaultMaxBakeAttempts is the number of times a bake job is claimed before
+// it is failed when the maximum number of attempts is not configured
+const DefaultMaxBakeAttempts = 3
+
+// RewrittenHistoryMode is how commits that are no longer reachable after a
+// repo's history has been rewritten (i.e., force-pushed) are reconciled
+type RewrittenHistoryMode string
+
+const (
+	// RewrittenHistoryMark marks unreachable commits using their
+	// "unreachable_at" column
+	RewrittenHistoryMark RewrittenHistoryMode = "mark"
+
+	// RewrittenHistoryDelete deletes unreachable commits
+	RewrittenHistoryDelete RewrittenHistoryMode = "delete"
+)
+
 // Config provides the configuration set on server startup
 // - Never Evict Repos: Repos that are preserved in cache regardless of LRU policy
+// - Bake Workers: The number of bake jobs that are processed concurrently
+// - Max Bake Attempts: How many times an abandoned bake job is retried before it is failed
+// - Rewritten History Mode: How unreachable commits are reconciled after a force-push
+// - Mailmap: A server-wide mailmap which takes precedence over a repo's ".mailmap"
+// - Max Commit Message Bytes: The length commit messages are truncated to, 0 for no limit
+// - Commit Stats: Whether line and file change statistics are collected for every bake
+// - All Refs Repos: Repos whose remote branches and tags are indexed on every bake
+// - Schedule Interval: How often known repos are re-baked, 0 to not re-bake them
+// - Schedule Jitter: The maximum delay added to each repo's schedule interval
+// - Schedule Repo Intervals: Repos re-baked on a different interval than the rest
+// - Webhook Secrets: The secrets push webhooks are verified with, by git provider
+// - Webhook Known Repos Only: Whether webhooks for repos that were never baked are rejected
+// - Callback Secret: The secret bake completion callbacks are signed with
+// - Shutdown Timeout: How long in-flight bakes are given to finish on shutdown
+// - Phase Timeouts: How long each phase of processing a job may take before it is abandoned
 type Config struct {
-	NeverEvictRepos providers.NeverEvictRepos
+	NeverEvictRepos       providers.NeverEvictRepos
+	BakeWorkers           int
+	MaxBakeAttempts       int
+	RewrittenHistoryMode  RewrittenHistoryMode
+	Mailmap               *mailmap.Mailmap
+	MaxCommitMessageBytes int
+	CommitStats           bool
+	AllRefsRepos          map[string]bool
+	ScheduleInterval      time.Duration
+	ScheduleJitter        time.Duration
+	ScheduleRepoIntervals map[string]time.Duration
+	WebhookSecrets        map[webhooks.Provider]string
+	WebhookKnownReposOnly bool
+	CallbackSecret        string
+	ShutdownTimeout       time.Duration
+	PhaseTimeouts         map[jobs.Phase]time.Duration
 }
 
-// PizzaOvenServer provides a leveled logger for use during serving requests
-// and a PizzaOvenDbHanlder for accessing a sql pool of connections.
+// PizzaOvenServer provides a leveled logger for use during serving requests,
+// a PizzaOvenDbHanlder for accessing a sql pool of connections and the
+// configuration for the bake workers that process queued jobs.
 type PizzaOvenServer struct {
 	Logger           *zap.SugaredLogger
 	PizzaOven        *database.PizzaOvenDbHandler
 	PizzaGitProvider providers.GitRepoProvider
+	Config           *Config
+
+	// wake is used to notify idle workers that a job has been queued by
+	// this server without having to wait for the next poll of the queue
+	wake chan struct{}
+
+	// draining is closed once the server begins shutting down and bakes
+	// tracks the jobs its workers are processing until they finish
+	draining chan struct{}
+	bakes    *inFlightBakes
+
+	// bakeCtx is the context jobs are processed within. It is cancelled by
+	// cancelBakes if in-flight bakes do not finish in time during shutdown.
+	bakeCtx     context.Context
+	cancelBakes context.CancelFunc
 }
 
 // NewPizzaOvenServer returns a PizzaOvenServer with a new leveled logger
 // which uses the provided PizzaOvenHandler for db connections
-func NewPizzaOvenServer(dbHandler *database.PizzaOvenDbHandler, provider providers.GitRepoProvider, sugarLogger *zap.SugaredLogger) *PizzaOvenServer {
+func NewPizzaOvenServer(dbHandler *database.PizzaOvenDbHandler, provider providers.GitRepoProvider, config *Config, sugarLogger *zap.SugaredLogger) *PizzaOvenServer {
+	bakeCtx, cancelBakes := context.WithCancel(context.Background())
+
 	return &PizzaOvenServer{
 		Logger:           sugarLogger,
 		PizzaOven:        dbHandler,
 		PizzaGitProvider: provider,
+		Config:           config,
+		wake:             make(chan struct{}, 1),
+		draining:         make(chan struct{}),
+		bakes:            newInFlightBakes(),
+		bakeCtx:          bakeCtx,
+		cancelBakes:      cancelBakes,
 	}
 }
 
-// Run starts the http server on the provided port
+// Run starts the http server on the provided port. It returns once the server
+// has been drained after receiving an interrupt or termination signal.
 func (p PizzaOvenServer) Run(serverPort string) {
 	//nolint:errcheck
 	defer p.Logger.Sync()
-	p.Logger.Infof("Starting server on port %s", serverPort)
-	http.HandleFunc("/bake", p.handleRequest)
-	http.HandleFunc("/ping", p.pingHandler)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%s", serverPort), nil))
+	p.startWorkers()
+	p.startScheduler()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/bake", p.handleRequest)
+	mux.HandleFunc("/bake/batch", p.handleBatchRequest)
+	mux.HandleFunc("/jobs/", p.handleJobStatus)
+	mux.HandleFunc("/repos", p.handleRepos)
+	mux.HandleFunc("/repos/", p.handleRepo)
+	mux.HandleFunc("/authors/", p.handleAuthor)
+	mux.HandleFunc("/webhooks/", p.handleWebhook)
+	mux.HandleFunc("/ping", p.pingHandler)
+
+	srv := &http.Server{
+		Addr:              fmt.Sprintf(":%s", serverPort),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		p.Logger.Infof("Starting server on port %s", serverPort)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	p.shutdown(srv)
 }
 
 type reqData struct {
-	URL  string `json:"url"`
-	Wait bool   `json:"wait,omitempty"`
+	URL     string     `json:"url"`
+	Wait    bool       `json:"wait,omitempty"`
+	Stats   bool       `json:"stats,omitempty"`
+	AllRefs bool       `json:"all_refs,omitempty"`
+	Ref     string     `json:"ref,omitempty"`
+	From    string     `json:"from,omitempty"`
+	To      string     `json:"to,omitempty"`
+	Since   *time.Time `json:"since,omitempty"`
+	Until   *time.Time `json:"until,omitempty"`
+	Force   bool       `json:"force,omitempty"`
+
+	// CallbackURL is notified with a signed POST when the bake finishes
+	CallbackURL string `json:"callback_url,omitempty"`
 }
 
 func (p PizzaOvenServer) handleRequest(w http.ResponseWriter, r *http.Request) {
@@ -74,6 +199,10 @@ func (p PizzaOvenServer) handleRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if p.rejectIfDraining(w) {
+		return
+	}
+
 	var data reqData
 	err := json.NewDecoder(r.Body).Decode(&data)
 	if err != nil {
@@ -82,51 +211,211 @@ func (p PizzaOvenServer) handleRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	p.Logger.Debugf("Validating and normalizing repository URL: %s", data.URL)
-	normalizedRepoURL, err := common.NormalizeGitURL(data.URL)
+	repoURL, err := p.validateRepoURL(r.Context(), data.URL)
 	if err != nil {
-		p.Logger.Debugf("Could not normalize repo URL %s: %s", data.URL, err.Error())
-		http.Error(w, fmt.Sprintf("Could not normalize provided repo URL: %s", err.Error()), http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	repoURLendpoint, err := transport.NewEndpoint(normalizedRepoURL)
+	opts := jobs.Options{
+		Stats:   data.Stats,
+		AllRefs: data.AllRefs,
+		Ref:     data.Ref,
+		From:    data.From,
+		To:      data.To,
+		Since:   data.Since,
+		Until:   data.Until,
+		Force:   data.Force,
+	}
+
+	err = opts.Validate()
 	if err != nil {
-		p.Logger.Errorf("Could not create git transport endpoint with repo URL %s: %s", data.URL, err.Error())
-		http.Error(w, fmt.Sprintf("Could not create git transport endpoint from provided repo URL: %s", err.Error()), http.StatusBadRequest)
+		p.Logger.Debugf("Invalid bake options for repo %s: %s", data.URL, err.Error())
+		http.Error(w, fmt.Sprintf("Invalid bake options: %s", err.Error()), http.StatusBadRequest)
 		return
 	}
 
-	ok, err := common.IsValidGitRepo(repoURLendpoint.String())
-	if !ok {
+	if data.CallbackURL != "" {
+		if p.Config.CallbackSecret == "" {
+			http.Error(w, "Callbacks are not enabled, a callback secret must be configured", http.StatusBadRequest)
+			return
+		}
+
+		err = validateCallbackURL(data.CallbackURL)
 		if err != nil {
-			p.Logger.Errorf("Error validating repo URL %s: %s", data.URL, err.Error())
-			http.Error(w, fmt.Sprintf("Error validating remote git repo URL: %s", err.Error()), http.StatusBadRequest)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+	}
 
-		p.Logger.Debug("Could not validate repo URL %s: %s", data.URL, err.Error())
-		http.Error(w, fmt.Sprintf("not valid git repo URL. Expected format protocol://address but got: %s", err.Error()), http.StatusBadRequest)
+	job, err := p.queueBakeJob(r.Context(), repoURL, opts, data.CallbackURL, r.RemoteAddr)
+	if err != nil {
+		http.Error(w, "Could not queue bake job", http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusAccepted)
 	if data.Wait {
-		err = p.processRepository(repoURLendpoint.String())
+		jobID := job.ID
+		job, err = p.waitForJob(r.Context(), jobID)
 		if err != nil {
-			p.Logger.Errorf("Could not process repository input: %v with error: %v", r.Body, err)
-			http.Error(w, "Could not process input", http.StatusInternalServerError)
+			p.Logger.Errorf("Could not wait for bake job %s: %s", jobID, err.Error())
+			http.Error(w, "Could not wait for bake job", http.StatusInternalServerError)
 			return
 		}
-	} else {
-		go func() {
-			err = p.processRepository(repoURLendpoint.String())
-			if err != nil {
-				p.Logger.Errorf("Could not process repository input: %v with error: %v", r.Body, err)
-				http.Error(w, "Could not process input", http.StatusInternalServerError)
-				return
-			}
-		}()
+
+		// Failed jobs are returned along with their error so that clients
+		// receive a job whether or not the bake succeeded
+		if job.Status == jobs.StatusFailed {
+			p.writeJSON(w, http.StatusInternalServerError, job)
+			return
+		}
+
+		// The wait ends early when the server is shutting down, in which
+		// case the job is still active and is returned as accepted
+		if !job.Status.IsFinished() {
+			p.writeJSON(w, http.StatusAccepted, job)
+			return
+		}
+
+		p.writeJSON(w, http.StatusOK, job)
+		return
+	}
+
+	p.writeJSON(w, http.StatusAccepted, job)
+}
+
+// normalizeRepoURL normalizes a repo URL to the form repos are stored and
+// queued with. The returned error describes why the URL is invalid.
+func (p PizzaOvenServer) normalizeRepoURL(rawURL string) (string, error) {
+	p.Logger.Debugf("Validating and normalizing repository URL: %s", rawURL)
+	normalizedRepoURL, err := common.NormalizeGitURL(rawURL)
+	if err != nil {
+		p.Logger.Debugf("Could not normalize repo URL %s: %s", rawURL, err.Error())
+		return "", fmt.Errorf("could not normalize provided repo URL: %s", err.Error())
+	}
+
+	repoURLendpoint, err := transport.NewEndpoint(normalizedRepoURL)
+	if err != nil {
+		p.Logger.Errorf("Could not create git transport endpoint with repo URL %s: %s", rawURL, err.Error())
+		return "", fmt.Errorf("could not create git transport endpoint from provided repo URL: %s", err.Error())
+	}
+
+	return repoURLendpoint.String(), nil
+}
+
+// validateRepoURL normalizes a repo URL and validates that it is a reachable
+// git repo. The returned error describes why the URL is invalid.
+func (p PizzaOvenServer) validateRepoURL(ctx context.Context, rawURL string) (string, error) {
+	repoURL, err := p.normalizeRepoURL(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	ok, err := common.IsValidGitRepo(ctx, repoURL)
+	if !ok {
+		if err != nil {
+			p.Logger.Errorf("Error validating repo URL %s: %s", rawURL, err.Error())
+			return "", fmt.Errorf("error validating remote git repo URL: %s", err.Error())
+		}
+
+		p.Logger.Debugf("Could not validate repo URL: %s", rawURL)
+		return "", fmt.Errorf("not valid git repo URL. Expected format protocol://address but got: %s", rawURL)
+	}
+
+	return repoURL, nil
+}
+
+// queueBakeJob queues a bake job for a validated repo URL, or returns the
+// active job of the repo with the same options, and wakes the workers. If a
+// callback URL is given, it is notified when the returned job finishes.
+func (p PizzaOvenServer) queueBakeJob(ctx context.Context, repoURL string, opts jobs.Options, callbackURL string, remoteAddr string) (*jobs.Job, error) {
+	for attempt := 0; ; attempt++ {
+		job, created, err := p.PizzaOven.InsertBakeJob(ctx, repoURL, opts)
+		if err != nil {
+			p.Logger.Errorf("Could not queue bake job for repo %s: %s", repoURL, err.Error())
+			return nil, err
+		}
+
+		if opts.Force {
+			p.Logger.Infow("Forced re-bake requested",
+				"audit", "force_rebake", "job_id", job.ID, "clone_url", job.RepoURL, "remote_addr", remoteAddr)
+		}
+
+		if created {
+			p.Logger.Debugf("Queued bake job %s for repo: %s", job.ID, job.RepoURL)
+			p.notifyWorkers()
+		} else {
+			p.Logger.Debugf("Attaching to active bake job %s for repo: %s", job.ID, job.RepoURL)
+		}
+
+		if callbackURL == "" {
+			return job, nil
+		}
+
+		added, err := p.PizzaOven.AddBakeJobCallback(ctx, job.ID, callbackURL)
+		if err != nil {
+			p.Logger.Errorf("Could not add callback to bake job %s: %s", job.ID, err.Error())
+			return nil, err
+		}
+
+		if added {
+			return job, nil
+		}
+
+		// The active job finished before the callback was added to it, so
+		// another job is queued for the callback to be notified of
+		if attempt == maxCallbackAttachAttempts {
+			return nil, fmt.Errorf("could not add callback to a bake job for %s after %d attempts", repoURL, attempt+1)
+		}
+	}
+}
+
+func (p PizzaOvenServer) handleJobStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		p.Logger.Errorf("Received job status request with invalid method: %s", r.Method)
+		http.Error(w, "Invalid request method, expected get", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, subroute, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/")
+	if _, err := uuid.Parse(id); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch subroute {
+	case "":
+	case "events":
+		p.handleJobEvents(w, r, id)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	job, err := p.PizzaOven.GetBakeJob(r.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			p.Logger.Debugf("Could not find bake job: %s", id)
+			http.Error(w, fmt.Sprintf("Could not find job: %s", id), http.StatusNotFound)
+			return
+		}
+
+		p.Logger.Errorf("Could not fetch bake job %s: %s", id, err.Error())
+		http.Error(w, "Could not fetch job", http.StatusInternalServerError)
+		return
+	}
+
+	p.writeJSON(w, http.StatusOK, job)
+}
+
+// writeJSON encodes the provided value as the json body of the response
+// using the given status code
+func (p PizzaOvenServer) writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		p.Logger.Errorf("Could not encode json response: %v", err)
 	}
 }
 
@@ -138,8 +427,44 @@ func (p PizzaOvenServer) pingHandler(w http.ResponseWriter, _ *http.Request) {
 	}
 }
 
-func (p PizzaOvenServer) processRepository(repoURL string) error {
+// authorIdentity is a unique name and email pair of a commit author
+type authorIdentity struct {
+	email string
+	name  string
+}
+
+// coAuthoredCommit links a commit, by its hash, to one of its co-authors
+type coAuthoredCommit struct {
+	hash     string
+	authorID int
+}
+
+// bakeResult is the outcome of baking a repository
+type bakeResult struct {
+	// repoID is the id of the baked repo, or 0 if the bake failed before it
+	// was found or inserted
+	repoID int
+
+	// commitsInserted and authorsInserted are the number of commits and
+	// commit authors that were new to the database
+	commitsInserted int64
+	authorsInserted int64
+}
+
+// processRepository bakes the given repository, returning the id of the repo
+// and the number of commits and authors that were inserted into the database.
+//
+// Each phase of the bake is abandoned once its configured timeout elapses or
+// the provided context is done. Transactions are begun with the provided
+// context, so they outlive the phases they span, and are rolled back if the
+// bake is abandoned before they are committed.
+func (p PizzaOvenServer) processRepository(ctx context.Context, repoURL string, opts jobs.Options, progress *jobProgress) (bakeResult, error) {
 	var err error
+	var result bakeResult
+
+	progress.enter(jobs.PhaseValidating)
+	validateCtx, cancelValidate := p.phaseContext(ctx, jobs.PhaseValidating)
+	defer cancelValidate()
 
 	insight := insights.CommitInsight{
 		RepoURLSource: repoURL,
@@ -149,28 +474,50 @@ func (p PizzaOvenServer) processRepository(repoURL string) error {
 	}
 
 	p.Logger.Debugf("Checking if repository is already in database: %s", insight.RepoURLSource)
-	repoID, err := p.PizzaOven.GetRepositoryID(insight)
+	repoID, err := p.PizzaOven.GetRepositoryID(validateCtx, insight)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			p.Logger.Debugf("No repo found in db. Inserting repo: %s", insight.RepoURLSource)
-			repoID, err = p.PizzaOven.InsertRepository(insight)
+			repoID, err = p.PizzaOven.InsertRepository(validateCtx, insight)
 			if err != nil {
 				p.Logger.Errorf("Failed to insert repository %s: %s", insight.RepoURLSource, err.Error())
-				return err
+				return result, err
 			}
 		} else {
 			p.Logger.Errorf("Failed to fetch repository ID: %s", err.Error())
-			return err
+			return result, err
 		}
 	}
+	result.repoID = repoID
+
+	// Hold an advisory lock on the repository for the duration of processing
+	// so that concurrent bakes of the same repo (possibly on other pizza oven
+	// instances) do not read the same state and insert duplicate commits
+	p.Logger.Debugf("Acquiring lock on repository: %s", insight.RepoURLSource)
+	repoLock, err := p.PizzaOven.AcquireRepositoryLock(validateCtx, repoID)
+	if err != nil {
+		p.Logger.Errorf("Failed to acquire lock on repository %s: %s", insight.RepoURLSource, err.Error())
+		return result, err
+	}
+	defer func() {
+		if err := repoLock.Release(); err != nil {
+			p.Logger.Errorf("Failed to release lock on repository %s: %s", insight.RepoURLSource, err.Error())
+		}
+	}()
 
+	progress.enter(jobs.PhaseFetching)
+	fetchCtx, cancelFetch := p.phaseContext(ctx, jobs.PhaseFetching)
+	defer cancelFetch()
 	p.Logger.Debugf("Getting repo via configured git provider: %s", insight.RepoURLSource)
 
-	// Use the configured git provider to get the repo
-	providedRepo, err := p.PizzaGitProvider.FetchRepo(insight.RepoURLSource)
+	// Use the configured git provider to get the repo. Bakes of every ref, or
+	// of a ref or commit range that may be on another branch, need every
+	// branch of the repo rather than only its default branch.
+	allBranches := opts.AllRefs || opts.Ref != "" || opts.From != "" || opts.To != ""
+	providedRepo, err := p.PizzaGitProvider.FetchRepo(fetchCtx, insight.RepoURLSource, allBranches)
 	if err != nil {
-		p.Logger.Error("Failed to fetch repository %s: %s", insight.RepoURLSource, err.Error())
-		return err
+		p.Logger.Errorf("Failed to fetch repository %s: %s", insight.RepoURLSource, err.Error())
+		return result, err
 	}
 	defer providedRepo.Done()
 
@@ -180,35 +527,40 @@ func (p PizzaOvenServer) processRepository(repoURL string) error {
 	ref, err := gitRepo.Head()
 	if err != nil {
 		p.Logger.Errorf("Could not find head of the git repo %s: %s", insight.RepoURLSource, err.Error())
-		return err
+		return result, err
 	}
 
-	p.Logger.Debugf("Getting last commit in DB: %s", insight.RepoURLSource)
-	latestCommitDate, err := p.PizzaOven.GetLastCommit(repoID)
+	// A targeted bake walks the given ref, commit range or date window
+	// without touching the repo's incremental state, i.e. its last indexed
+	// HEAD and refs, so it can be used to backfill a repo's history
+	var plan *bakePlan
+	if opts.IsTargeted() {
+		p.Logger.Debugf("Planning targeted bake of %s with options: %+v", insight.RepoURLSource, opts)
+		plan, err = planTargetedBake(gitRepo, ref.Hash(), opts)
+	} else {
+		plan, err = p.planIncrementalBake(fetchCtx, gitRepo, repoID, ref.Hash(), opts, insight.RepoURLSource)
+	}
 	if err != nil {
-		p.Logger.Errorf("Could not fetch the latest commit date in %s: %s", insight.RepoURLSource, err.Error())
-		return err
+		p.Logger.Errorf("Could not plan the bake of %s: %s", insight.RepoURLSource, err.Error())
+		return result, err
 	}
 
-	// Add 1 nanosecond since "git log --since" is inclusive of date/times.
-	// Although date/times are not unique to commits, it is incredibly unlikely that
-	// two commits will have the exact same timestamp and be excluded using this method
-	latestCommitDate = latestCommitDate.Add(time.Nanosecond)
-	p.Logger.Debugf("Querying commits since: %s", latestCommitDate.String())
-
-	// Git shortlog options to display summary and email starting at HEAD
-	gitLogOptions := git.LogOptions{
-		From:  ref.Hash(),
-		Since: &latestCommitDate,
+	if plan.upToDate {
+		return result, nil
 	}
 
-	p.Logger.Debugf("Getting commit iterator with git log options: %v", gitLogOptions)
-	authorIter, err := gitRepo.Log(&gitLogOptions)
+	p.Logger.Debugf("Getting commit iterator from %d heads skipping %d known commits", len(plan.heads), len(plan.known))
+	authorIter, err := plan.commitIter(gitRepo)
 	if err != nil {
 		p.Logger.Errorf("Failed to retrieve commit iterator: %s", err.Error())
-		return err
+		return result, err
 	}
 
+	// Commit identities are resolved to their canonical identity using the
+	// repo's ".mailmap" at HEAD and the server-wide mailmap
+	p.Logger.Debugf("Building mailmap from HEAD of the git repo: %s", insight.RepoURLSource)
+	identities := p.buildMailmap(gitRepo, ref.Hash(), insight.RepoURLSource)
+
 	// Build a unique, atomically safe temporary table name to pivot commit
 	// author data from
 	rawUUID := uuid.New().String()
@@ -216,113 +568,337 @@ func (p PizzaOvenServer) processRepository(repoURL string) error {
 	tmpTableName := fmt.Sprintf("temp_table_%s_%d", uuid, atomic.AddInt64(&counter, 1))
 
 	p.Logger.Debugf("Using temporary db table for commit authors: %s", tmpTableName)
-	authorTxn, authorStmt, err := p.PizzaOven.PrepareBulkAuthorInsert(tmpTableName)
+	authorTxn, authorStmt, err := p.PizzaOven.PrepareBulkAuthorInsert(ctx, tmpTableName)
 	if err != nil {
 		p.Logger.Errorf("Failed to prepare the bulk author insert process: %s", err.Error())
-		return err
+		return result, err
 	}
 
+	// Rolling back is a no-op once the transaction has been committed
+	//nolint:errcheck
+	defer authorTxn.Rollback()
+
 	// To reduce unnecessary duplicate statement executions, track the unique
 	// author emails using a simple set (represented as a string map to structs)
+	// and the unique name and email identities along with when they were seen
 	uniqueAuthorEmails := []string{}
 	authorEmailSet := make(map[string]struct{})
+	authorIdentities := make(map[authorIdentity]*insights.AuthorInsight)
 
+	seen := func(email, name string, when time.Time) {
+		if _, ok := authorEmailSet[email]; !ok {
+			authorEmailSet[email] = struct{}{}
+			uniqueAuthorEmails = append(uniqueAuthorEmails, email)
+		}
+
+		identity := authorIdentity{email: email, name: name}
+		author, ok := authorIdentities[identity]
+		if !ok {
+			author = &insights.AuthorInsight{Email: email, Name: name}
+			authorIdentities[identity] = author
+		}
+
+		author.Seen(when.UTC())
+	}
+
+	progress.enter(jobs.PhaseWalkingAuthors)
+	walkCtx, cancelWalk := p.phaseContext(ctx, jobs.PhaseWalkingAuthors)
+	defer cancelWalk()
 	p.Logger.Debugf("Iterating commit authors in repository: %s with temporary tablename: %s", insight.RepoURLSource, tmpTableName)
 	err = authorIter.ForEach(func(c *object.Commit) error {
-		// TODO - if the committer and author are not the same, handle both
-		// those users. This is the case where there is a separate committer for
-		// a patch that was not authored by that specific person making the commit.
+		if err := walkCtx.Err(); err != nil {
+			return err
+		}
 
-		// TODO - if there is a co-author, should handle adding that person on
-		// the commit as well.
+		progress.walked()
 
-		// Check if the author email is in the unique set of author emails
-		if _, ok := authorEmailSet[c.Author.Email]; ok {
-			return nil
-		}
+		// The author, the committer and any co-authors of a commit are all
+		// stored as commit authors. The author and committer differ when a
+		// patch was committed by someone other than the person who authored it.
+		authorName, authorEmail := identities.Resolve(c.Author.Name, c.Author.Email)
+		seen(authorEmail, authorName, c.Author.When)
+
+		committerName, committerEmail := identities.Resolve(c.Committer.Name, c.Committer.Email)
+		seen(committerEmail, committerName, c.Committer.When)
 
-		// Commit author is not in set so add this author's email as unique
-		authorEmailSet[c.Author.Email] = struct{}{}
-		uniqueAuthorEmails = append(uniqueAuthorEmails, c.Author.Email)
+		for _, coAuthor := range insights.ParseCoAuthors(c.Message) {
+			coAuthorName, coAuthorEmail := identities.Resolve(coAuthor.Name, coAuthor.Email)
+			seen(coAuthorEmail, coAuthorName, c.Author.When)
+		}
 
-		p.Logger.Debugf("Inspecting commit author: %s", c.Author.Email)
-		return p.PizzaOven.InsertAuthor(authorStmt, insights.CommitInsight{
-			RepoURLSource: repoURL,
-			AuthorEmail:   c.Author.Email,
-			Hash:          "",
-			Date:          time.Time{},
-		})
+		return nil
 	})
 	if err != nil {
-		p.Logger.Errorf("Failed to insert author: %s", err.Error())
-		return err
+		p.Logger.Errorf("Failed to iterate authors: %s", err.Error())
+		return result, err
 	}
 
-	// Resolve, execute, and pivot the bulk author transaction
-	err = p.PizzaOven.ResolveTransaction(authorTxn, authorStmt)
-	if err != nil {
-		p.Logger.Errorf("Failed to resolve bulk author transaction: %s", err.Error())
-		return err
+	for _, author := range authorIdentities {
+		p.Logger.Debugf("Inspecting commit author: %s <%s>", author.Name, author.Email)
+		err = p.PizzaOven.InsertAuthor(walkCtx, authorStmt, *author)
+		if err != nil {
+			p.Logger.Errorf("Failed to insert author: %s", err.Error())
+			return result, err
+		}
 	}
 
-	err = p.PizzaOven.PivotTmpTableToAuthorsTable(tmpTableName)
+	// Execute, pivot, and commit the bulk author transaction
+	progress.enter(jobs.PhasePivotingAuthors)
+	pivotCtx, cancelPivot := p.phaseContext(ctx, jobs.PhasePivotingAuthors)
+	defer cancelPivot()
+	result.authorsInserted, err = p.PizzaOven.PivotTmpTableToAuthorsTable(pivotCtx, authorTxn, authorStmt, tmpTableName)
 	if err != nil {
 		p.Logger.Errorf("Failed to pivot the temporary authors table: %s", err.Error())
-		return err
+		return result, err
 	}
 
 	// Re-query the database for author email ids based on the unique list of
 	// author emails that have just been committed
-	authorEmailIDMap, err := p.PizzaOven.GetAuthorIDs(uniqueAuthorEmails)
+	authorEmailIDMap, err := p.PizzaOven.GetAuthorIDs(pivotCtx, uniqueAuthorEmails)
 	if err != nil {
 		p.Logger.Errorf("Failed to create the author-email/id map: %s", err.Error())
-		return err
+		return result, err
 	}
 
-	// Rebuild the iterator from the start using the same options
-	commitIter, err := gitRepo.Log(&gitLogOptions)
+	// Rebuild the iterator from the start skipping the same known commits
+	commitIter, err := plan.commitIter(gitRepo)
 	if err != nil {
 		p.Logger.Errorf("Failed to rebuild the commit iterator: %s", err.Error())
-		return err
+		return result, err
+	}
+
+	// Get ready for the commit bulk action using a new temporary table to
+	// pivot commits from
+	commitTmpTableName := fmt.Sprintf("temp_table_%s_%d", uuid, atomic.AddInt64(&counter, 1))
+
+	progress.enter(jobs.PhaseInsertingCommits)
+	insertCtx, cancelInsert := p.phaseContext(ctx, jobs.PhaseInsertingCommits)
+	defer cancelInsert()
+
+	commitTxn, err := p.PizzaOven.BeginRepositoryTransaction(ctx)
+	if err != nil {
+		p.Logger.Errorf("Failed to begin the repository transaction: %s", err.Error())
+		return result, err
+	}
+
+	// Rolling back is a no-op once the transaction has been committed
+	//nolint:errcheck
+	defer commitTxn.Rollback()
+
+	// A forced bake deletes the existing commits of the repo within the same
+	// transaction the repo is indexed from scratch in, so the repo's data is
+	// never partially missing
+	if opts.Force {
+		commitsDeleted, err := p.PizzaOven.PurgeRepository(insertCtx, commitTxn, repoID)
+		if err != nil {
+			p.Logger.Errorf("Failed to purge repository %s: %s", insight.RepoURLSource, err.Error())
+			return result, err
+		}
+
+		p.Logger.Infow("Purged repository for forced re-bake",
+			"audit", "force_rebake", "repo_id", repoID, "clone_url", insight.RepoURLSource, "commits_deleted", commitsDeleted)
 	}
 
-	// Get ready for the commit bulk action
-	commitTxn, commitStmt, err := p.PizzaOven.PrepareBulkCommitInsert()
+	p.Logger.Debugf("Using temporary db table for commits: %s", commitTmpTableName)
+	commitStmt, err := p.PizzaOven.PrepareBulkCommitInsert(insertCtx, commitTxn, commitTmpTableName)
 	if err != nil {
 		p.Logger.Errorf("Failed to prepare bulk commit insert process: %s", err.Error())
-		return err
+		return result, err
 	}
 
+	// Co-authors can only be linked to commits once the commits have been
+	// pivoted into the commits table, so they are collected and inserted
+	// in bulk afterwards
+	coAuthoredCommits := []coAuthoredCommit{}
+
+	// The UTC days of the walked commits are the days of the commit activity
+	// rollup which are affected by the bake
+	activityDays := make(map[time.Time]struct{})
+
 	p.Logger.Debugf("Iterating commits in repository: %s", insight.RepoURLSource)
 	err = commitIter.ForEach(func(c *object.Commit) error {
+		if err := insertCtx.Err(); err != nil {
+			return err
+		}
+
+		progress.walked()
+
+		parentHashes := make([]string, 0, len(c.ParentHashes))
+		for _, parentHash := range c.ParentHashes {
+			parentHashes = append(parentHashes, parentHash.String())
+		}
+
 		i := insights.CommitInsight{
-			RepoURLSource: repoURL,
-			AuthorEmail:   c.Author.Email,
-			Hash:          c.Hash.String(),
-			Date:          c.Committer.When.UTC(),
+			RepoURLSource:     repoURL,
+			RawAuthorEmail:    c.Author.Email,
+			RawCommitterEmail: c.Committer.Email,
+			Hash:              c.Hash.String(),
+			Date:              c.Committer.When.UTC(),
+			AuthorDate:        c.Author.When.UTC(),
+			Subject:           insights.MessageSubject(c.Message),
+			Message:           insights.TruncateMessage(c.Message, p.Config.MaxCommitMessageBytes),
+			ParentHashes:      parentHashes,
+			IsMerge:           len(parentHashes) > 1,
 		}
+		i.AuthorName, i.AuthorEmail = identities.Resolve(c.Author.Name, c.Author.Email)
+		i.CommitterName, i.CommitterEmail = identities.Resolve(c.Committer.Name, c.Committer.Email)
+
+		activityDays[utcDay(i.Date)] = struct{}{}
 
-		p.Logger.Debugf("Inspecting commit: %s %s %s", i.AuthorEmail, i.Hash, i.Date)
-		err = p.PizzaOven.InsertCommit(commitStmt, i, authorEmailIDMap[i.AuthorEmail], repoID)
+		p.Logger.Debugf("Inspecting commit: %s %s %s %s", i.AuthorEmail, i.CommitterEmail, i.Hash, i.Date)
+		err = p.PizzaOven.InsertCommit(insertCtx, commitStmt, i, authorEmailIDMap[i.AuthorEmail], authorEmailIDMap[i.CommitterEmail], repoID)
 		if err != nil {
 			p.Logger.Errorf("Failed to insert commit: %s", err.Error())
 			return err
 		}
 
+		for _, coAuthor := range insights.ParseCoAuthors(c.Message) {
+			_, coAuthorEmail := identities.Resolve(coAuthor.Name, coAuthor.Email)
+			coAuthoredCommits = append(coAuthoredCommits, coAuthoredCommit{
+				hash:     i.Hash,
+				authorID: authorEmailIDMap[coAuthorEmail],
+			})
+		}
+
 		return nil
 	})
 	if err != nil {
 		p.Logger.Errorf("Failed to insert commit: %s", err.Error())
-		return err
+		return result, err
+	}
+
+	// Execute the bulk commit insert and pivot the new commits into the
+	// commits table, skipping any that have already been indexed
+	commitsInserted, err := p.PizzaOven.PivotTmpTableToCommitsTable(insertCtx, commitTxn, commitStmt, commitTmpTableName)
+	if err != nil {
+		p.Logger.Errorf("Could not pivot the temporary commits table: %v", err.Error())
+		return result, err
+	}
+
+	if opts.Stats {
+		fileChangeTmpTableName := fmt.Sprintf("temp_table_%s_%d", uuid, atomic.AddInt64(&counter, 1))
+
+		p.Logger.Debugf("Inserting commit file changes using temporary db table: %s", fileChangeTmpTableName)
+		fileChangeStmt, err := p.PizzaOven.PrepareBulkFileChangeInsert(insertCtx, commitTxn, fileChangeTmpTableName)
+		if err != nil {
+			p.Logger.Errorf("Failed to prepare bulk file change insert process: %s", err.Error())
+			return result, err
+		}
+
+		fileChangeIter, err := plan.commitIter(gitRepo)
+		if err != nil {
+			p.Logger.Errorf("Could not get commit iterator: %s", err.Error())
+			return result, err
+		}
+
+		err = p.insertCommitFileChanges(insertCtx, fileChangeStmt, fileChangeIter)
+		if err != nil {
+			p.Logger.Errorf("Failed to insert commit file changes: %s", err.Error())
+			return result, err
+		}
+
+		err = p.PizzaOven.PivotTmpTableToFileChangesTable(insertCtx, commitTxn, fileChangeStmt, fileChangeTmpTableName, repoID)
+		if err != nil {
+			p.Logger.Errorf("Could not pivot the temporary file changes table: %v", err.Error())
+			return result, err
+		}
+	}
+
+	if len(coAuthoredCommits) > 0 {
+		coAuthorTmpTableName := fmt.Sprintf("temp_table_%s_%d", uuid, atomic.AddInt64(&counter, 1))
+
+		p.Logger.Debugf("Inserting %d commit co-authors using temporary db table: %s", len(coAuthoredCommits), coAuthorTmpTableName)
+		coAuthorStmt, err := p.PizzaOven.PrepareBulkCoAuthorInsert(insertCtx, commitTxn, coAuthorTmpTableName)
+		if err != nil {
+			p.Logger.Errorf("Failed to prepare bulk co-author insert process: %s", err.Error())
+			return result, err
+		}
+
+		for _, coAuthored := range coAuthoredCommits {
+			err = p.PizzaOven.InsertCoAuthor(insertCtx, coAuthorStmt, coAuthored.hash, coAuthored.authorID)
+			if err != nil {
+				p.Logger.Errorf("Failed to insert commit co-author: %s", err.Error())
+				return result, err
+			}
+		}
+
+		err = p.PizzaOven.PivotTmpTableToCoAuthorsTable(insertCtx, commitTxn, coAuthorStmt, coAuthorTmpTableName, repoID)
+		if err != nil {
+			p.Logger.Errorf("Could not pivot the temporary co-authors table: %v", err.Error())
+			return result, err
+		}
+	}
+
+	if opts.AllRefs {
+		refTmpTableName := fmt.Sprintf("temp_table_%s_%d", uuid, atomic.AddInt64(&counter, 1))
+		refCommitTmpTableName := fmt.Sprintf("temp_table_%s_%d", uuid, atomic.AddInt64(&counter, 1))
+
+		p.Logger.Debugf("Indexing %d refs, %d updated, using temporary db tables: %s, %s", len(plan.refs), len(plan.refUpdates), refTmpTableName, refCommitTmpTableName)
+		err = p.indexRefs(insertCtx, commitTxn, gitRepo, repoID, plan.refs, plan.refUpdates, refTmpTableName, refCommitTmpTableName)
+		if err != nil {
+			p.Logger.Errorf("Could not index the refs of %s: %v", insight.RepoURLSource, err.Error())
+			return result, err
+		}
+	}
+
+	// Commits that were only reachable from the rewritten history are
+	// reconciled in the same transaction so the repo's commits always reflect
+	// the current history. Commits on refs that were indexed by other bakes
+	// remain reachable.
+	if plan.rewritten {
+		heads, ok, err := p.reconcileHeads(insertCtx, gitRepo, plan.heads, repoID, insight.RepoURLSource, opts.AllRefs)
+		if err != nil {
+			p.Logger.Errorf("Could not determine the reachable commits of %s: %v", insight.RepoURLSource, err.Error())
+			return result, err
+		}
+
+		if ok {
+			reachableTmpTableName := fmt.Sprintf("temp_table_%s_%d", uuid, atomic.AddInt64(&counter, 1))
+
+			p.Logger.Debugf("Reconciling unreachable commits using temporary db table: %s", reachableTmpTableName)
+			reconciled, err := p.reconcileRewrittenHistory(insertCtx, commitTxn, gitRepo, heads, repoID, reachableTmpTableName)
+			if err != nil {
+				p.Logger.Errorf("Could not reconcile the rewritten history of %s: %v", insight.RepoURLSource, err.Error())
+				return result, err
+			}
+
+			p.Logger.Infof("Reconciled %d unreachable commits of %s using mode: %s", reconciled, insight.RepoURLSource, p.Config.RewrittenHistoryMode)
+		} else {
+			p.Logger.Warnf("Not all indexed refs of %s were fetched, leaving its unreachable commits to be reconciled by a bake of all refs", insight.RepoURLSource)
+		}
+	}
+
+	// Forced bakes and rewritten histories may change the commits of any day
+	// so the entire rollup of the repo is rebuilt
+	if opts.Force || plan.rewritten {
+		p.Logger.Debugf("Rebuilding the commit activity of: %s", insight.RepoURLSource)
+		err = p.PizzaOven.RebuildCommitActivity(insertCtx, commitTxn, repoID)
+	} else {
+		p.Logger.Debugf("Refreshing the commit activity of %d days: %s", len(activityDays), insight.RepoURLSource)
+		err = p.PizzaOven.RefreshCommitActivity(insertCtx, commitTxn, repoID, sortedDays(activityDays))
+	}
+	if err != nil {
+		p.Logger.Errorf("Could not update the commit activity of %s: %v", insight.RepoURLSource, err.Error())
+		return result, err
+	}
+
+	// Record the new HEAD in the same transaction so the next bake of this
+	// repo only walks the commits that are not reachable from it
+	if !plan.targeted {
+		err = p.PizzaOven.UpdateLastIndexedHash(insertCtx, commitTxn, repoID, ref.Hash().String())
+		if err != nil {
+			p.Logger.Errorf("Could not update the last indexed HEAD: %v", err.Error())
+			return result, err
+		}
 	}
 
-	// Execute and resolve the bulk commit insert
-	err = p.PizzaOven.ResolveTransaction(commitTxn, commitStmt)
+	err = commitTxn.Commit()
 	if err != nil {
-		p.Logger.Errorf("Could not resolve bulk commit insert transaction %v", err.Error())
-		return err
+		p.Logger.Errorf("Could not commit the bulk commit insert transaction: %v", err.Error())
+		return result, err
 	}
 
 	p.Logger.Debugf("Finished processing: %s", insight.RepoURLSource)
-	return nil
+	result.commitsInserted = commitsInserted
+	return result, nil
 }
@@ -0,0 +1,272 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/open-sauced/pizza/oven/pkg/insights"
+	"github.com/open-sauced/pizza/oven/pkg/jobs"
+)
+
+func TestHandleRequestRejections(t *testing.T) {
+	t.Parallel()
+
+	p := PizzaOvenServer{Logger: zap.NewNop().Sugar(), Config: &Config{}}
+	repoURL := testRepoURL(t, 1)
+	missingRepo := "file://" + filepath.Join(t.TempDir(), "missing")
+	hash := strings.Repeat("a", 40)
+
+	tests := []struct {
+		name         string
+		method       string
+		body         string
+		expectStatus int
+		expectError  string
+	}{
+		{
+			name:         "Invalid method",
+			method:       http.MethodGet,
+			body:         `{"url": "` + repoURL + `"}`,
+			expectStatus: http.StatusMethodNotAllowed,
+			expectError:  "expected post",
+		},
+		{
+			name:         "Malformed body",
+			body:         `["` + repoURL + `"]`,
+			expectStatus: http.StatusBadRequest,
+			expectError:  "Could not decode request body",
+		},
+		{
+			name:         "Mistyped option",
+			body:         `{"url": "` + repoURL + `", "stats": "yes"}`,
+			expectStatus: http.StatusBadRequest,
+			expectError:  "Could not decode request body",
+		},
+		{
+			name:         "Malformed since",
+			body:         `{"url": "` + repoURL + `", "since": "yesterday"}`,
+			expectStatus: http.StatusBadRequest,
+			expectError:  "Could not decode request body",
+		},
+		{
+			name:         "Missing URL",
+			body:         `{}`,
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			name:         "Unsupported URL scheme",
+			body:         `{"url": "ftp://example.com/repo"}`,
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			name:         "Unreachable repo",
+			body:         `{"url": "` + missingRepo + `"}`,
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			name:         "Abbreviated from hash",
+			body:         `{"url": "` + repoURL + `", "from": "abc123"}`,
+			expectStatus: http.StatusBadRequest,
+			expectError:  "from must be a full commit hash",
+		},
+		{
+			name:         "Ref with to",
+			body:         `{"url": "` + repoURL + `", "ref": "main", "to": "` + hash + `"}`,
+			expectStatus: http.StatusBadRequest,
+			expectError:  "ref and to can not be combined",
+		},
+		{
+			name:         "Since after until",
+			body:         `{"url": "` + repoURL + `", "since": "2023-02-01T00:00:00Z", "until": "2023-01-01T00:00:00Z"}`,
+			expectStatus: http.StatusBadRequest,
+			expectError:  "since must not be after until",
+		},
+		{
+			name:         "All refs with ref",
+			body:         `{"url": "` + repoURL + `", "all_refs": true, "ref": "main"}`,
+			expectStatus: http.StatusBadRequest,
+			expectError:  "all_refs can not be combined",
+		},
+		{
+			name:         "Force with since",
+			body:         `{"url": "` + repoURL + `", "force": true, "since": "2023-01-01T00:00:00Z"}`,
+			expectStatus: http.StatusBadRequest,
+			expectError:  "force can not be combined",
+		},
+		{
+			name:         "Callback without a configured secret",
+			body:         `{"url": "` + repoURL + `", "callback_url": "https://example.com/baked"}`,
+			expectStatus: http.StatusBadRequest,
+			expectError:  "Callbacks are not enabled",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodPost
+			}
+
+			w := httptest.NewRecorder()
+			p.handleRequest(w, httptest.NewRequest(method, "/bake", strings.NewReader(tt.body)))
+
+			if w.Code != tt.expectStatus {
+				t.Fatalf("status: %d is not expected: %d: %s", w.Code, tt.expectStatus, w.Body.String())
+			}
+
+			if !strings.Contains(w.Body.String(), tt.expectError) {
+				t.Fatalf("error: %q does not contain: %q", w.Body.String(), tt.expectError)
+			}
+		})
+	}
+
+	// Callback URLs are validated once callbacks are enabled
+	p.Config = &Config{CallbackSecret: "secret"}
+	for _, callbackURL := range []string{"/baked", "ftp://example.com/baked", "https://"} {
+		w := httptest.NewRecorder()
+		body := `{"url": "` + repoURL + `", "callback_url": "` + callbackURL + `"}`
+		p.handleRequest(w, httptest.NewRequest(http.MethodPost, "/bake", strings.NewReader(body)))
+
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "invalid callback URL") {
+			t.Errorf("callback URL: %s status: %d is not expected: %d: %s", callbackURL, w.Code, http.StatusBadRequest, w.Body.String())
+		}
+	}
+}
+
+func TestHandleRequest(t *testing.T) {
+	p := testPizzaOvenServer(t)
+	p.Config.CallbackSecret = "secret"
+
+	repoURL := testRepoURL(t, 1)
+	hash := strings.Repeat("a", 40)
+	since := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2023, time.February, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		body          string
+		expectOptions jobs.Options
+	}{
+		{
+			name: "URL only",
+			body: `{"url": "` + repoURL + `"}`,
+		},
+		{
+			name:          "Stats of every ref",
+			body:          `{"url": "` + repoURL + `", "stats": true, "all_refs": true}`,
+			expectOptions: jobs.Options{Stats: true, AllRefs: true},
+		},
+		{
+			name:          "Ref from a commit",
+			body:          `{"url": "` + repoURL + `", "ref": "main", "from": "` + hash + `"}`,
+			expectOptions: jobs.Options{Ref: "main", From: hash},
+		},
+		{
+			name:          "Date window",
+			body:          `{"url": "` + repoURL + `", "since": "2023-01-01T00:00:00Z", "until": "2023-02-01T00:00:00Z"}`,
+			expectOptions: jobs.Options{Since: &since, Until: &until},
+		},
+		{
+			name:          "Forced with a callback",
+			body:          `{"url": "` + repoURL + `", "force": true, "callback_url": "https://example.com/baked"}`,
+			expectOptions: jobs.Options{Force: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			p.handleRequest(w, httptest.NewRequest(http.MethodPost, "/bake", strings.NewReader(tt.body)))
+
+			if w.Code != http.StatusAccepted {
+				t.Fatalf("status: %d is not expected: %d: %s", w.Code, http.StatusAccepted, w.Body.String())
+			}
+
+			var job jobs.Job
+			err := json.NewDecoder(w.Body).Decode(&job)
+			if err != nil {
+				t.Fatalf("unexpected err decoding job: %s", err.Error())
+			}
+
+			if job.Status != jobs.StatusQueued || !reflect.DeepEqual(job.Options, tt.expectOptions) {
+				t.Fatalf("job: %+v is not expected to be queued with options: %+v", job, tt.expectOptions)
+			}
+		})
+	}
+}
+
+func TestHandleRequestWait(t *testing.T) {
+	p := testPizzaOvenServer(t)
+	ctx := context.Background()
+
+	go p.worker(0)
+	t.Cleanup(func() {
+		close(p.draining)
+	})
+
+	repoURL := testRepoURL(t, 2)
+	t.Cleanup(func() {
+		repoID, err := p.PizzaOven.GetRepositoryID(ctx, insights.CommitInsight{RepoURLSource: repoURL})
+		if err == nil {
+			//nolint:errcheck
+			p.PizzaOven.DeleteRepository(ctx, repoID)
+		}
+	})
+
+	tests := []struct {
+		name         string
+		body         string
+		expectStatus int
+		expectJob    jobs.Status
+	}{
+		{
+			name:         "Succeeded bake",
+			body:         `{"url": "` + repoURL + `", "wait": true}`,
+			expectStatus: http.StatusOK,
+			expectJob:    jobs.StatusSucceeded,
+		},
+		{
+			name:         "Failed bake",
+			body:         `{"url": "` + repoURL + `", "wait": true, "ref": "missing"}`,
+			expectStatus: http.StatusInternalServerError,
+			expectJob:    jobs.StatusFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			p.handleRequest(w, httptest.NewRequest(http.MethodPost, "/bake", strings.NewReader(tt.body)))
+
+			if w.Code != tt.expectStatus {
+				t.Fatalf("status: %d is not expected: %d: %s", w.Code, tt.expectStatus, w.Body.String())
+			}
+
+			// Failed bakes return the job, along with its error, like
+			// succeeded ones do
+			var job jobs.Job
+			err := json.NewDecoder(w.Body).Decode(&job)
+			if err != nil {
+				t.Fatalf("unexpected err decoding job: %s", err.Error())
+			}
+
+			if job.ID == "" || job.Status != tt.expectJob {
+				t.Fatalf("job: %+v is not expected to have status: %s", job, tt.expectJob)
+			}
+
+			if (job.Status == jobs.StatusFailed) != (job.Error != "") {
+				t.Fatalf("job: %+v is not expected to have an error: %t", job, job.Status == jobs.StatusFailed)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultShutdownTimeout is how long in-flight bakes are given to finish on
+// shutdown when the timeout is not configured. It leaves room within the
+// default 30 second termination grace period of Kubernetes pods.
+const DefaultShutdownTimeout = 25 * time.Second
+
+// shutdownCancelGrace is how long bakes that are cancelled during shutdown
+// are given to roll back their transactions and requeue their jobs
+const shutdownCancelGrace = 3 * time.Second
+
+// inFlightBakes tracks the jobs being processed by the workers of a server,
+// by the claim ids of the workers' attempts at them, so that shutdown may wait
+// for them to finish and requeue those that don't. The callbacks of finished
+// jobs are waited for along with the workers.
+type inFlightBakes struct {
+	wg sync.WaitGroup
+
+	mu   sync.Mutex
+	jobs map[string]struct{}
+
+	// closed is set once shutdown has begun waiting for the in-flight bakes,
+	// after which no more may be added
+	closed bool
+}
+
+func newInFlightBakes() *inFlightBakes {
+	return &inFlightBakes{
+		jobs: make(map[string]struct{}),
+	}
+}
+
+// add counts a worker claiming a job, or a callback being sent, as in-flight.
+// It returns false, without counting it, once shutdown has begun waiting for
+// the in-flight bakes. Every successful add must be followed by a done.
+func (b *inFlightBakes) add() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return false
+	}
+
+	b.wg.Add(1)
+	return true
+}
+
+// done records that a worker or callback counted by add is no longer in-flight
+func (b *inFlightBakes) done() {
+	b.wg.Done()
+}
+
+// start records that the job claimed with the given claim id is being processed
+func (b *inFlightBakes) start(claimID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.jobs[claimID] = struct{}{}
+}
+
+// finish records that the job claimed with the given claim id is no longer
+// being processed
+func (b *inFlightBakes) finish(claimID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.jobs, claimID)
+}
+
+// running returns the claim ids of the jobs that are still being processed
+func (b *inFlightBakes) running() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ids := make([]string, 0, len(b.jobs))
+	for id := range b.jobs {
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+// wait blocks until every worker has stopped or the context is done. It
+// returns false if workers were still running when the context was done. No
+// more workers or callbacks may be added once it has been called.
+func (b *inFlightBakes) wait(ctx context.Context) bool {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// isDraining returns true once the server has begun shutting down
+func (p PizzaOvenServer) isDraining() bool {
+	select {
+	case <-p.draining:
+		return true
+	default:
+		return false
+	}
+}
+
+// rejectIfDraining responds that the server is unavailable, so the client may
+// retry against another instance, if it has begun shutting down. It returns
+// true if the request was rejected.
+func (p PizzaOvenServer) rejectIfDraining(w http.ResponseWriter) bool {
+	if !p.isDraining() {
+		return false
+	}
+
+	w.Header().Set("Connection", "close")
+	http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+	return true
+}
+
+// shutdown drains the server. New bakes are rejected and workers stop
+// claiming jobs while the in-flight bakes, and the callbacks of finished
+// bakes, are given until the configured timeout to finish, releasing the
+// locks on their repos as they do. Bakes that are still running afterwards
+// are cancelled, rolling back their transactions, and their jobs are
+// requeued for another instance to retry. Finally, the database connection
+// pool is closed.
+func (p PizzaOvenServer) shutdown(srv *http.Server) {
+	timeout := p.Config.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+
+	p.Logger.Infof("Shutting down, waiting up to %s for in-flight bakes to finish", timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	close(p.draining)
+
+	// Requests waiting on a job or streaming its events return as soon as
+	// the server is draining so they do not hold up the shutdown of the
+	// http server
+	if err := srv.Shutdown(ctx); err != nil {
+		p.Logger.Errorf("Could not gracefully shut down the http server: %s", err.Error())
+	}
+
+	if p.bakes.wait(ctx) {
+		p.Logger.Infof("All in-flight bakes finished")
+	} else {
+		p.Logger.Warnf("Shutdown timeout elapsed with %d bakes still running, cancelling them", len(p.bakes.running()))
+		p.requeueUnfinishedBakes()
+	}
+
+	if err := p.PizzaOven.Close(); err != nil {
+		p.Logger.Errorf("Could not close the database connection pool: %s", err.Error())
+	}
+}
+
+// requeueUnfinishedBakes cancels the in-flight bakes, which requeue their own
+// jobs once they have rolled back, and requeues the jobs of any bakes that
+// have not stopped within the grace period
+func (p PizzaOvenServer) requeueUnfinishedBakes() {
+	p.cancelBakes()
+
+	graceCtx, cancelGrace := context.WithTimeout(context.Background(), shutdownCancelGrace)
+	defer cancelGrace()
+
+	if p.bakes.wait(graceCtx) {
+		return
+	}
+
+	claimIDs := p.bakes.running()
+	ctx, cancel := queueContext()
+	defer cancel()
+
+	requeued, err := p.PizzaOven.RequeueBakeJobs(ctx, claimIDs)
+	if err != nil {
+		p.Logger.Errorf("Could not requeue unfinished bake jobs: %s", err.Error())
+		return
+	}
+
+	p.Logger.Infof("Requeued %d unfinished bake jobs", requeued)
+}
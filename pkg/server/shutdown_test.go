@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/open-sauced/pizza/oven/pkg/webhooks"
+)
+
+func TestInFlightBakesWait(t *testing.T) {
+	t.Parallel()
+
+	bakes := newInFlightBakes()
+	if !bakes.add() {
+		t.Fatalf("bake was not added before shutdown began waiting")
+	}
+	bakes.start("job-1")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if bakes.wait(ctx) {
+		t.Fatalf("expected wait to time out with a bake in flight")
+	}
+
+	running := bakes.running()
+	if len(running) != 1 || running[0] != "job-1" {
+		t.Fatalf("running jobs: %v are not expected: [job-1]", running)
+	}
+
+	// No more bakes may be added once shutdown has begun waiting
+	if bakes.add() {
+		t.Fatalf("bake was added after shutdown began waiting")
+	}
+
+	bakes.finish("job-1")
+	bakes.done()
+
+	if !bakes.wait(context.Background()) {
+		t.Fatalf("expected wait to return once the bake finished")
+	}
+
+	if running := bakes.running(); len(running) != 0 {
+		t.Fatalf("expected no running jobs, got: %v", running)
+	}
+}
+
+func TestRejectIfDraining(t *testing.T) {
+	t.Parallel()
+
+	p := PizzaOvenServer{
+		Logger:   zap.NewNop().Sugar(),
+		Config:   &Config{WebhookSecrets: map[webhooks.Provider]string{webhooks.GitHub: "secret"}},
+		draining: make(chan struct{}),
+	}
+
+	w := httptest.NewRecorder()
+	if p.rejectIfDraining(w) {
+		t.Fatalf("request was rejected before the server began draining")
+	}
+
+	close(p.draining)
+
+	handlers := map[string]http.HandlerFunc{
+		"/bake":            p.handleRequest,
+		"/bake/batch":      p.handleBatchRequest,
+		"/webhooks/github": p.handleWebhook,
+	}
+
+	for path, handler := range handlers {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{}`)))
+
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s status: %d is not expected: %d", path, w.Code, http.StatusServiceUnavailable)
+		}
+	}
+}
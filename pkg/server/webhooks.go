@@ -0,0 +1,103 @@
+package server
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/open-sauced/pizza/oven/pkg/insights"
+	"github.com/open-sauced/pizza/oven/pkg/jobs"
+	"github.com/open-sauced/pizza/oven/pkg/webhooks"
+)
+
+// maxWebhookBytes is the maximum size of a webhook payload. GitHub, the most
+// generous of the providers, caps its payloads at 25MB.
+const maxWebhookBytes = 25 << 20
+
+// webhookResponse is the response body of a webhook. Events other than pushes
+// are acknowledged and ignored.
+type webhookResponse struct {
+	Event   string    `json:"event"`
+	Ignored bool      `json:"ignored,omitempty"`
+	Job     *jobs.Job `json:"job,omitempty"`
+}
+
+// handleWebhook queues a bake of the repo of a push event sent as a webhook by
+// a git hosting provider. Only providers configured with a secret are served.
+func (p PizzaOvenServer) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	provider := webhooks.Provider(strings.TrimPrefix(r.URL.Path, "/webhooks/"))
+	secret, ok := p.Config.WebhookSecrets[provider]
+	if !ok || !provider.Valid() {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		p.Logger.Errorf("Received %s webhook with invalid method: %s", provider, r.Method)
+		http.Error(w, "Invalid request method, expected post", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if p.rejectIfDraining(w) {
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBytes))
+	if err != nil {
+		p.Logger.Errorf("Could not read %s webhook body: %s", provider, err.Error())
+		http.Error(w, "Could not read request body", http.StatusBadRequest)
+		return
+	}
+
+	err = provider.Verify(r.Header, body, secret)
+	if err != nil {
+		p.Logger.Warnf("Rejected %s webhook from %s: %s", provider, r.RemoteAddr, err.Error())
+		http.Error(w, "Invalid webhook signature", http.StatusUnauthorized)
+		return
+	}
+
+	event := provider.Event(r.Header)
+	if !provider.IsPush(event) {
+		p.Logger.Debugf("Ignoring %s webhook event: %s", provider, event)
+		p.writeJSON(w, http.StatusOK, webhookResponse{Event: event, Ignored: true})
+		return
+	}
+
+	cloneURL, err := provider.PushCloneURL(body)
+	if err != nil {
+		p.Logger.Debugf("Could not parse %s push event: %s", provider, err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	repoURL, err := p.normalizeRepoURL(cloneURL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if p.Config.WebhookKnownReposOnly {
+		_, err = p.PizzaOven.GetRepositoryID(r.Context(), insights.CommitInsight{RepoURLSource: repoURL})
+		if err != nil {
+			if err == sql.ErrNoRows {
+				p.Logger.Debugf("Rejected %s push event for unknown repo: %s", provider, repoURL)
+				http.Error(w, fmt.Sprintf("Repo has not been baked: %s", repoURL), http.StatusForbidden)
+				return
+			}
+
+			p.Logger.Errorf("Could not fetch repo %s: %s", repoURL, err.Error())
+			http.Error(w, "Could not fetch repo", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	job, err := p.queueBakeJob(r.Context(), repoURL, jobs.Options{}, "", r.RemoteAddr)
+	if err != nil {
+		http.Error(w, "Could not queue bake job", http.StatusInternalServerError)
+		return
+	}
+
+	p.writeJSON(w, http.StatusAccepted, webhookResponse{Event: event, Job: job})
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/open-sauced/pizza/oven/pkg/webhooks"
+)
+
+func TestHandleWebhook(t *testing.T) {
+	t.Parallel()
+
+	secret := "pizza"
+	p := PizzaOvenServer{
+		Logger: zap.NewNop().Sugar(),
+		Config: &Config{WebhookSecrets: map[webhooks.Provider]string{webhooks.GitHub: secret}},
+	}
+
+	sign := func(body string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(body))
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	tests := []struct {
+		name         string
+		path         string
+		event        string
+		body         string
+		signature    string
+		expectStatus int
+	}{
+		{
+			name:         "Provider without a secret",
+			path:         "/webhooks/gitlab",
+			event:        "Push Hook",
+			body:         `{}`,
+			expectStatus: http.StatusNotFound,
+		},
+		{
+			name:         "Unsupported provider",
+			path:         "/webhooks/bitbucket",
+			body:         `{}`,
+			expectStatus: http.StatusNotFound,
+		},
+		{
+			name:         "Invalid signature",
+			path:         "/webhooks/github",
+			event:        "push",
+			body:         `{"repository":{"clone_url":"https://github.com/open-sauced/pizza.git"}}`,
+			signature:    sign(`{}`),
+			expectStatus: http.StatusUnauthorized,
+		},
+		{
+			name:         "Ping event is ignored",
+			path:         "/webhooks/github",
+			event:        "ping",
+			body:         `{"zen":"Keep it logically awesome."}`,
+			signature:    sign(`{"zen":"Keep it logically awesome."}`),
+			expectStatus: http.StatusOK,
+		},
+		{
+			name:         "Push without clone URL",
+			path:         "/webhooks/github",
+			event:        "push",
+			body:         `{"ref":"refs/heads/main"}`,
+			signature:    sign(`{"ref":"refs/heads/main"}`),
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			name:         "Push with invalid clone URL",
+			path:         "/webhooks/github",
+			event:        "push",
+			body:         `{"repository":{"clone_url":"ftp://github.com/open-sauced/pizza.git"}}`,
+			signature:    sign(`{"repository":{"clone_url":"ftp://github.com/open-sauced/pizza.git"}}`),
+			expectStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			r.Header.Set("X-GitHub-Event", tt.event)
+			r.Header.Set("X-Gitlab-Event", tt.event)
+			r.Header.Set("X-Hub-Signature-256", tt.signature)
+
+			w := httptest.NewRecorder()
+			p.handleWebhook(w, r)
+
+			if w.Code != tt.expectStatus {
+				t.Fatalf("status: %d is not expected: %d - %s", w.Code, tt.expectStatus, w.Body.String())
+			}
+		})
+	}
+}
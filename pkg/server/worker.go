@@ -0,0 +1,255 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/open-sauced/pizza/oven/pkg/database"
+	"github.com/open-sauced/pizza/oven/pkg/jobs"
+)
+
+const (
+	// jobPollInterval is how often idle workers check the queue for jobs
+	// queued by other pizza oven instances
+	jobPollInterval = 5 * time.Second
+
+	// jobHeartbeatInterval is how often a worker records that a running
+	// job is still being processed
+	jobHeartbeatInterval = 15 * time.Second
+
+	// jobStaleAfter is how long a running job may go without a heartbeat
+	// before it is considered abandoned and may be claimed by another worker
+	jobStaleAfter = 2 * time.Minute
+
+	// jobWaitInterval is how often the status of a job is checked when a
+	// client has requested to wait for its completion
+	jobWaitInterval = time.Second
+
+	// jobQueryTimeout bounds the queries made to maintain the bake queue, such
+	// as claiming jobs and recording their heartbeats and results, which are
+	// not part of any phase of processing a job
+	jobQueryTimeout = 30 * time.Second
+)
+
+// queueContext returns a context for a query made to maintain the bake queue
+func queueContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), jobQueryTimeout)
+}
+
+// phaseContext returns the context a phase of processing a job is performed
+// within, which is done once the configured timeout of the phase, if any,
+// has elapsed
+func (p PizzaOvenServer) phaseContext(ctx context.Context, phase jobs.Phase) (context.Context, context.CancelFunc) {
+	timeout := p.Config.PhaseTimeouts[phase]
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// startWorkers starts the configured number of bake workers. Each worker
+// claims and processes jobs from the durable bake queue one at a time, which
+// bounds the number of repositories processed concurrently by this server.
+func (p PizzaOvenServer) startWorkers() {
+	workers := p.Config.BakeWorkers
+	if workers <= 0 {
+		workers = DefaultBakeWorkers
+	}
+
+	p.Logger.Infof("Starting %d bake workers", workers)
+	for i := 0; i < workers; i++ {
+		go p.worker(i)
+	}
+}
+
+// worker drains the bake queue and then waits until it is either notified
+// of a new job or the poll interval has elapsed. It stops once the server
+// begins shutting down.
+func (p PizzaOvenServer) worker(workerID int) {
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	for !p.isDraining() {
+		if p.claimAndRunJob(workerID) {
+			continue
+		}
+
+		select {
+		case <-p.wake:
+		case <-ticker.C:
+		case <-p.draining:
+		}
+	}
+
+	p.Logger.Debugf("Worker %d stopped", workerID)
+}
+
+// notifyWorkers wakes an idle worker, if there is one, to claim a newly
+// queued job
+func (p PizzaOvenServer) notifyWorkers() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// claimAndRunJob claims a single job from the queue and processes it.
+// It returns true if a job was claimed.
+func (p PizzaOvenServer) claimAndRunJob(workerID int) bool {
+	// The worker is counted as in-flight before it claims a job so that a
+	// shutdown that begins while it is claiming one waits for it. Once
+	// shutdown is waiting for the in-flight bakes, no more jobs are claimed.
+	if !p.bakes.add() {
+		return false
+	}
+	defer p.bakes.done()
+
+	ctx, cancel := queueContext()
+	defer cancel()
+
+	maxAttempts := p.Config.MaxBakeAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxBakeAttempts
+	}
+
+	p.failAbandonedJobs(ctx, workerID, maxAttempts)
+
+	job, err := p.PizzaOven.ClaimBakeJob(ctx, jobStaleAfter, maxAttempts)
+	if err != nil {
+		p.Logger.Errorf("Worker %d could not claim bake job: %s", workerID, err.Error())
+		return false
+	}
+
+	if job == nil {
+		return false
+	}
+
+	p.Logger.Debugf("Worker %d claimed bake job %s for repo: %s", workerID, job.ID, job.RepoURL)
+	p.bakes.start(job.ClaimID)
+	defer p.bakes.finish(job.ClaimID)
+	p.runJob(job)
+	return true
+}
+
+// failAbandonedJobs fails the jobs that were abandoned on their last attempt,
+// i.e. because they crash the instance processing them, and notifies their
+// callbacks
+func (p PizzaOvenServer) failAbandonedJobs(ctx context.Context, workerID int, maxAttempts int) {
+	failed, err := p.PizzaOven.FailAbandonedBakeJobs(ctx, jobStaleAfter, maxAttempts)
+	if err != nil {
+		p.Logger.Errorf("Worker %d could not fail abandoned bake jobs: %s", workerID, err.Error())
+		return
+	}
+
+	for _, job := range failed {
+		p.Logger.Errorf("Bake job %s for repo %s was abandoned after %d attempts", job.ID, job.RepoURL, job.Attempts)
+		p.notifyCallbacksInBackground(job, bakeResult{}, 0)
+	}
+}
+
+// runJob processes the repository for the given claimed job, periodically
+// recording a heartbeat while it runs and then recording its result. Jobs
+// that are cancelled because the server is shutting down are requeued
+// instead, once their transactions have been rolled back. Jobs that were
+// re-claimed by another worker are cancelled and their result is discarded.
+func (p PizzaOvenServer) runJob(job *jobs.Job) {
+	jobCtx, cancelJob := context.WithCancel(p.bakeCtx)
+	defer cancelJob()
+
+	stopHeartbeat := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(jobHeartbeatInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stopHeartbeat:
+				return
+			case <-ticker.C:
+				ctx, cancel := queueContext()
+				err := p.PizzaOven.HeartbeatBakeJob(ctx, job.ID, job.ClaimID)
+				cancel()
+
+				if err == database.ErrBakeJobLost {
+					p.Logger.Warnf("Bake job %s was claimed by another worker, cancelling it: %s", job.ID, job.RepoURL)
+					cancelJob()
+					return
+				}
+
+				if err != nil {
+					p.Logger.Errorf("Could not record heartbeat for bake job %s: %s", job.ID, err.Error())
+				}
+			}
+		}
+	}()
+
+	// The server-wide configuration can enable statistics for every bake and
+	// the indexing of all refs for individual repos, unless the bake targets
+	// a specific ref, commit range or date window
+	opts := job.Options
+	opts.Stats = opts.Stats || p.Config.CommitStats
+	opts.AllRefs = opts.AllRefs || (p.Config.AllRefsRepos[job.RepoURL] && !opts.IsTargeted())
+
+	start := time.Now()
+	result, err := p.processRepository(jobCtx, job.RepoURL, opts, p.newJobProgress(job.ID))
+	duration := time.Since(start)
+	close(stopHeartbeat)
+
+	ctx, cancel := queueContext()
+	defer cancel()
+
+	if err != nil && p.bakeCtx.Err() != nil {
+		p.Logger.Warnf("Bake job %s was cancelled by shutdown, requeueing it: %s", job.ID, job.RepoURL)
+		if _, err := p.PizzaOven.RequeueBakeJobs(ctx, []string{job.ClaimID}); err != nil {
+			p.Logger.Errorf("Could not requeue bake job %s: %s", job.ID, err.Error())
+		}
+
+		return
+	}
+
+	if err != nil {
+		p.Logger.Errorf("Could not process repository for job %s: %s with error: %v", job.ID, job.RepoURL, err)
+	}
+
+	finishedJob, err := p.PizzaOven.FinishBakeJob(ctx, job.ID, job.ClaimID, result.commitsInserted, err)
+	if err == database.ErrBakeJobLost {
+		p.Logger.Warnf("Bake job %s was claimed by another worker, discarding its result: %s", job.ID, job.RepoURL)
+		return
+	}
+
+	if err != nil {
+		p.Logger.Errorf("Could not record result of bake job %s: %s", job.ID, err.Error())
+		return
+	}
+
+	p.notifyCallbacksInBackground(finishedJob, result, duration)
+}
+
+// waitForJob blocks until the job with the given id has finished or the
+// provided context is done. The job may be processed by any worker sharing
+// the bake queue, so its status is polled from the database. If the server
+// begins shutting down, the job is returned as it was last polled.
+func (p PizzaOvenServer) waitForJob(ctx context.Context, id string) (*jobs.Job, error) {
+	ticker := time.NewTicker(jobWaitInterval)
+	defer ticker.Stop()
+
+	for {
+		job, err := p.PizzaOven.GetBakeJob(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		if job.Status.IsFinished() {
+			return job, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-p.draining:
+			return job, nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"go.uber.org/zap"
+
+	"github.com/open-sauced/pizza/oven/pkg/database"
+	"github.com/open-sauced/pizza/oven/pkg/insights"
+	"github.com/open-sauced/pizza/oven/pkg/internal/testutil"
+	"github.com/open-sauced/pizza/oven/pkg/jobs"
+	"github.com/open-sauced/pizza/oven/pkg/providers"
+)
+
+// testPizzaOvenServer is a convenience method for testing that returns a
+// server using the in-memory git provider and the test database. See
+// testutil.Database.
+func testPizzaOvenServer(t *testing.T) *PizzaOvenServer {
+	t.Helper()
+
+	_, config := testutil.Database(t)
+
+	logger := zap.NewNop().Sugar()
+	pizzaOven := database.NewPizzaOvenDbHandler(config.Host, config.Port, config.User, config.Password, config.DBName, "disable")
+	t.Cleanup(func() {
+		//nolint:errcheck
+		pizzaOven.Close()
+	})
+
+	return NewPizzaOvenServer(pizzaOven, providers.NewInMemoryGitRepoProvider(logger), &Config{}, logger)
+}
+
+// testRepoURL is a convenience method for testing that creates a local repo
+// with the given number of commits and returns its URL
+func testRepoURL(t *testing.T, commits int) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatalf("unexpected err initializing repo: %s", err.Error())
+	}
+
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("unexpected err getting worktree: %s", err.Error())
+	}
+
+	now := time.Now()
+	for i := 0; i < commits; i++ {
+		testCommit(t, w, fmt.Sprintf("commit %d", i), now.Add(time.Duration(i-commits)*time.Hour))
+	}
+
+	return "file://" + dir
+}
+
+func TestPhaseContext(t *testing.T) {
+	t.Parallel()
+
+	p := PizzaOvenServer{
+		Config: &Config{
+			PhaseTimeouts: map[jobs.Phase]time.Duration{
+				jobs.PhaseFetching: time.Minute,
+			},
+		},
+	}
+
+	// Phases with a configured timeout have a deadline
+	ctx, cancel := p.phaseContext(context.Background(), jobs.PhaseFetching)
+	defer cancel()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		t.Fatalf("expected a deadline for phase: %s", jobs.PhaseFetching)
+	}
+
+	if until := time.Until(deadline); until <= 0 || until > time.Minute {
+		t.Fatalf("deadline in: %s is not expected: at most %s", until, time.Minute)
+	}
+
+	// Phases without a timeout are only done with their parent
+	parent, cancelParent := context.WithCancel(context.Background())
+	ctx, cancel = p.phaseContext(parent, jobs.PhaseInsertingCommits)
+	defer cancel()
+
+	if _, ok := ctx.Deadline(); ok {
+		t.Fatalf("unexpected deadline for phase: %s", jobs.PhaseInsertingCommits)
+	}
+
+	cancelParent()
+	if ctx.Err() != context.Canceled {
+		t.Fatalf("phase context was not cancelled with its parent: %v", ctx.Err())
+	}
+}
+
+func TestClaimAndRunJob(t *testing.T) {
+	p := testPizzaOvenServer(t)
+	ctx := context.Background()
+
+	if p.claimAndRunJob(0) {
+		t.Fatalf("claimed a job from an empty queue")
+	}
+
+	repoURL := testRepoURL(t, 3)
+	job, _, err := p.PizzaOven.InsertBakeJob(ctx, repoURL, jobs.Options{})
+	if err != nil {
+		t.Fatalf("unexpected err queueing job: %s", err.Error())
+	}
+	t.Cleanup(func() {
+		repoID, err := p.PizzaOven.GetRepositoryID(ctx, insights.CommitInsight{RepoURLSource: repoURL})
+		if err == nil {
+			//nolint:errcheck
+			p.PizzaOven.DeleteRepository(ctx, repoID)
+		}
+	})
+
+	if !p.claimAndRunJob(0) {
+		t.Fatalf("did not claim queued job: %s", job.ID)
+	}
+
+	finished, err := p.PizzaOven.GetBakeJob(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("unexpected err fetching job: %s", err.Error())
+	}
+
+	if finished.Status != jobs.StatusSucceeded || finished.CommitsInserted != 3 || finished.Attempts != 1 {
+		t.Fatalf("finished job: %+v is not expected to have succeeded with 3 commits", finished)
+	}
+
+	if running := p.bakes.running(); len(running) != 0 {
+		t.Fatalf("expected no running jobs, got: %v", running)
+	}
+}
+
+func TestWorker(t *testing.T) {
+	p := testPizzaOvenServer(t)
+	ctx := context.Background()
+
+	stopped := make(chan struct{})
+	go func() {
+		p.worker(0)
+		close(stopped)
+	}()
+
+	// Idle workers are woken as soon as a job is queued by this server,
+	// rather than on the next poll of the queue
+	repoURL := testRepoURL(t, 2)
+	job, err := p.queueBakeJob(ctx, repoURL, jobs.Options{}, "", "")
+	if err != nil {
+		t.Fatalf("unexpected err queueing job: %s", err.Error())
+	}
+	t.Cleanup(func() {
+		repoID, err := p.PizzaOven.GetRepositoryID(ctx, insights.CommitInsight{RepoURLSource: repoURL})
+		if err == nil {
+			//nolint:errcheck
+			p.PizzaOven.DeleteRepository(ctx, repoID)
+		}
+	})
+
+	waitCtx, cancel := context.WithTimeout(ctx, jobPollInterval-time.Second)
+	defer cancel()
+
+	finished, err := p.waitForJob(waitCtx, job.ID)
+	if err != nil {
+		t.Fatalf("unexpected err waiting for job: %s", err.Error())
+	}
+
+	if finished.Status != jobs.StatusSucceeded || finished.CommitsInserted != 2 {
+		t.Fatalf("finished job: %+v is not expected to have succeeded with 2 commits", finished)
+	}
+
+	// Workers stop once the server begins draining
+	close(p.draining)
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatalf("worker did not stop once the server began draining")
+	}
+}
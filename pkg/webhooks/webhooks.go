@@ -0,0 +1,153 @@
+// package webhooks verifies the webhooks sent by git hosting providers and
+// extracts the repos of their push events.
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Provider is a git hosting provider which sends webhooks
+type Provider string
+
+const (
+	// GitHub signs the body of webhooks with an HMAC-SHA256 of the secret in
+	// the "X-Hub-Signature-256" header
+	GitHub Provider = "github"
+
+	// GitLab sends the secret token as is in the "X-Gitlab-Token" header
+	GitLab Provider = "gitlab"
+
+	// Gitea signs the body of webhooks with an HMAC-SHA256 of the secret in
+	// the "X-Gitea-Signature" header
+	Gitea Provider = "gitea"
+)
+
+// ErrInvalidSignature is returned when a webhook is not signed with the
+// configured secret of its provider
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Valid returns true if the provider is one of the supported providers
+func (p Provider) Valid() bool {
+	switch p {
+	case GitHub, GitLab, Gitea:
+		return true
+	default:
+		return false
+	}
+}
+
+// Verify checks that the webhook with the given headers and body was sent by
+// the provider using the given secret
+func (p Provider) Verify(header http.Header, body []byte, secret string) error {
+	switch p {
+	case GitHub:
+		signature, ok := strings.CutPrefix(header.Get("X-Hub-Signature-256"), "sha256=")
+		if !ok {
+			return ErrInvalidSignature
+		}
+
+		return verifyHMAC(body, secret, signature)
+	case GitLab:
+		if subtle.ConstantTimeCompare([]byte(header.Get("X-Gitlab-Token")), []byte(secret)) != 1 {
+			return ErrInvalidSignature
+		}
+
+		return nil
+	case Gitea:
+		return verifyHMAC(body, secret, header.Get("X-Gitea-Signature"))
+	default:
+		return fmt.Errorf("unsupported webhook provider: %s", p)
+	}
+}
+
+// Event returns the name of the event of the webhook with the given headers
+func (p Provider) Event(header http.Header) string {
+	switch p {
+	case GitHub:
+		return header.Get("X-GitHub-Event")
+	case GitLab:
+		return header.Get("X-Gitlab-Event")
+	case Gitea:
+		return header.Get("X-Gitea-Event")
+	default:
+		return ""
+	}
+}
+
+// IsPush returns true if the event is a push of branches or tags to a repo
+func (p Provider) IsPush(event string) bool {
+	switch p {
+	case GitHub, Gitea:
+		return event == "push"
+	case GitLab:
+		return event == "Push Hook" || event == "Tag Push Hook"
+	default:
+		return false
+	}
+}
+
+// pushPayload contains the clone URLs of the repo in the push event payloads
+// of all providers
+type pushPayload struct {
+	Repository struct {
+		CloneURL   string `json:"clone_url"`
+		GitHTTPURL string `json:"git_http_url"`
+	} `json:"repository"`
+	Project struct {
+		GitHTTPURL string `json:"git_http_url"`
+	} `json:"project"`
+}
+
+// PushCloneURL returns the HTTP clone URL of the repo of a push event payload
+func (p Provider) PushCloneURL(body []byte) (string, error) {
+	var payload pushPayload
+	err := json.Unmarshal(body, &payload)
+	if err != nil {
+		return "", fmt.Errorf("could not decode push event payload: %s", err.Error())
+	}
+
+	var cloneURL string
+	switch p {
+	case GitHub, Gitea:
+		cloneURL = payload.Repository.CloneURL
+	case GitLab:
+		cloneURL = payload.Project.GitHTTPURL
+		if cloneURL == "" {
+			cloneURL = payload.Repository.GitHTTPURL
+		}
+	default:
+		return "", fmt.Errorf("unsupported webhook provider: %s", p)
+	}
+
+	if cloneURL == "" {
+		return "", fmt.Errorf("push event payload has no clone URL")
+	}
+
+	return cloneURL, nil
+}
+
+// verifyHMAC checks that the hex encoded signature is the HMAC-SHA256 of the
+// body using the secret
+func verifyHMAC(body []byte, secret string, signature string) error {
+	decoded, err := hex.DecodeString(signature)
+	if err != nil || signature == "" {
+		return ErrInvalidSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	//nolint:errcheck
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), decoded) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
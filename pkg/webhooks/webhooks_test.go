@@ -0,0 +1,170 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"testing"
+)
+
+func sign(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerify(t *testing.T) {
+	t.Parallel()
+
+	secret := "pizza"
+	body := []byte(`{"ref":"refs/heads/main"}`)
+
+	tests := []struct {
+		name      string
+		provider  Provider
+		header    http.Header
+		expectErr bool
+	}{
+		{
+			name:     "GitHub valid signature",
+			provider: GitHub,
+			header:   http.Header{"X-Hub-Signature-256": {"sha256=" + sign(body, secret)}},
+		},
+		{
+			name:      "GitHub signed with another secret",
+			provider:  GitHub,
+			header:    http.Header{"X-Hub-Signature-256": {"sha256=" + sign(body, "not pizza")}},
+			expectErr: true,
+		},
+		{
+			name:      "GitHub missing prefix",
+			provider:  GitHub,
+			header:    http.Header{"X-Hub-Signature-256": {sign(body, secret)}},
+			expectErr: true,
+		},
+		{
+			name:      "GitHub missing signature",
+			provider:  GitHub,
+			header:    http.Header{},
+			expectErr: true,
+		},
+		{
+			name:     "GitLab valid token",
+			provider: GitLab,
+			header:   http.Header{"X-Gitlab-Token": {secret}},
+		},
+		{
+			name:      "GitLab invalid token",
+			provider:  GitLab,
+			header:    http.Header{"X-Gitlab-Token": {"not pizza"}},
+			expectErr: true,
+		},
+		{
+			name:     "Gitea valid signature",
+			provider: Gitea,
+			header:   http.Header{"X-Gitea-Signature": {sign(body, secret)}},
+		},
+		{
+			name:      "Gitea invalid signature",
+			provider:  Gitea,
+			header:    http.Header{"X-Gitea-Signature": {"not hex"}},
+			expectErr: true,
+		},
+		{
+			name:      "Unsupported provider",
+			provider:  Provider("bitbucket"),
+			header:    http.Header{},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.provider.Verify(tt.header, body, secret)
+			if tt.expectErr && err == nil {
+				t.Fatalf("expected err verifying webhook, got none")
+			}
+
+			if !tt.expectErr && err != nil {
+				t.Fatalf("unexpected err verifying webhook: %s", err.Error())
+			}
+		})
+	}
+}
+
+func TestPushCloneURL(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		provider    Provider
+		body        string
+		expectURL   string
+		expectErr   bool
+		expectEvent string
+		header      http.Header
+	}{
+		{
+			name:        "GitHub push",
+			provider:    GitHub,
+			body:        `{"ref":"refs/heads/main","repository":{"clone_url":"https://github.com/open-sauced/pizza.git"}}`,
+			expectURL:   "https://github.com/open-sauced/pizza.git",
+			expectEvent: "push",
+			header:      http.Header{"X-Github-Event": {"push"}},
+		},
+		{
+			name:        "GitLab push",
+			provider:    GitLab,
+			body:        `{"object_kind":"push","project":{"git_http_url":"https://gitlab.com/open-sauced/pizza.git"}}`,
+			expectURL:   "https://gitlab.com/open-sauced/pizza.git",
+			expectEvent: "Push Hook",
+			header:      http.Header{"X-Gitlab-Event": {"Push Hook"}},
+		},
+		{
+			name:        "Gitea push",
+			provider:    Gitea,
+			body:        `{"ref":"refs/heads/main","repository":{"clone_url":"https://gitea.com/open-sauced/pizza.git"}}`,
+			expectURL:   "https://gitea.com/open-sauced/pizza.git",
+			expectEvent: "push",
+			header:      http.Header{"X-Gitea-Event": {"push"}},
+		},
+		{
+			name:      "Missing clone URL",
+			provider:  GitHub,
+			body:      `{"zen":"Keep it logically awesome."}`,
+			expectErr: true,
+		},
+		{
+			name:      "Malformed payload",
+			provider:  Gitea,
+			body:      `not json`,
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cloneURL, err := tt.provider.PushCloneURL([]byte(tt.body))
+			if tt.expectErr {
+				if err == nil {
+					t.Fatalf("expected err parsing push event, got none")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected err parsing push event: %s", err.Error())
+			}
+
+			if cloneURL != tt.expectURL {
+				t.Fatalf("clone URL: %s is not expected: %s", cloneURL, tt.expectURL)
+			}
+
+			event := tt.provider.Event(tt.header)
+			if event != tt.expectEvent || !tt.provider.IsPush(event) {
+				t.Fatalf("event: %s is not expected push event: %s", event, tt.expectEvent)
+			}
+		})
+	}
+}